@@ -0,0 +1,351 @@
+// Package admin serves live inspection of named collections on a Unix
+// domain socket, see package admin/client for the Go client.
+//
+// Requests and replies are single lines. A request is a command, the
+// collection name and the argument, if any, separated by spaces:
+//
+//	list                          names of the registered collections
+//	list <name>                   keys, sorted
+//	get <name> <key>              entry with revision
+//	len <name>                    number of entries
+//	stats <name>                  len, rev and deleted count
+//	dump <name> <file>            write the values as JSON lines to file
+//	purge-deleted <name>          remove the entries marked as deleted
+//
+// The reply is "ok " followed by the JSON encoded result or "err "
+// followed by the message. Anyone who can connect can read every
+// collection and write files as the server process, the socket is
+// created with mode 0600
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pkpowell/syncmap"
+)
+
+var (
+	// ErrExists is returned when registering a name twice
+	ErrExists = errors.New("admin: collection already registered")
+	// ErrInUse is returned when another server listens on the socket
+	ErrInUse = errors.New("admin: socket in use")
+	// ErrNoPurge is returned by purge-deleted without Options.IsDeleted
+	ErrNoPurge = errors.New("admin: purge-deleted needs IsDeleted")
+)
+
+// maxLine caps the size of one request
+const maxLine = 64 << 10
+
+// Options configures a registered collection
+type Options[K syncmap.MapKey, V syncmap.MapValue] struct {
+	// ParseKey converts the get argument to a key, required unless K is a string
+	ParseKey func(string) (K, error)
+	// IsDeleted reports if v is marked as deleted, required by
+	// purge-deleted and the deleted count of stats
+	IsDeleted func(v V) bool
+}
+
+// Entry is the reply of get
+type Entry struct {
+	Key   string `json:"key"`
+	Rev   uint64 `json:"rev"`
+	Value any    `json:"value"`
+}
+
+// Stats is the reply of stats, Deleted is -1 without Options.IsDeleted
+type Stats struct {
+	Len     int    `json:"len"`
+	Rev     uint64 `json:"rev"`
+	Deleted int    `json:"deleted"`
+}
+
+// collection is a registered collection with its type parameters hidden
+type collection interface {
+	keys() []string
+	get(key string) (Entry, error)
+	len() int
+	stats() Stats
+	dump(file string) (int64, error)
+	purgeDeleted() (int, error)
+}
+
+// Server answers admin requests for the registered collections
+type Server struct {
+	mtx   sync.RWMutex
+	colls map[string]collection
+}
+
+// NewServer creates a server without collections
+func NewServer() *Server {
+	return &Server{colls: make(map[string]collection)}
+}
+
+// Register makes c available as name
+func Register[K syncmap.MapKey, V syncmap.MapValue](s *Server, name string, c *syncmap.Collection[K, V], opts Options[K, V]) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("admin: invalid collection name %q", name)
+	}
+	if opts.ParseKey == nil {
+		opts.ParseKey = func(s string) (k K, err error) {
+			p, ok := any(&k).(*string)
+			if !ok {
+				return k, fmt.Errorf("admin: no ParseKey for %T", k)
+			}
+			*p = s
+			return k, nil
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.colls[name]; ok {
+		return ErrExists
+	}
+	s.colls[name] = &adapter[K, V]{c: c, opts: opts}
+	return nil
+}
+
+// Unregister removes the collection name
+func (s *Server) Unregister(name string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.colls, name)
+}
+
+// ListenAndServe serves on a Unix socket at path until ctx is done. A
+// stale socket file nobody listens on is replaced, ErrInUse is returned
+// if a server answers at path. The file is removed on return
+func (s *Server) ListenAndServe(ctx context.Context, path string) error {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return ErrInUse
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is done, closes ln and waits
+// for the connections to finish
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			ln.Close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ServeConn(ctx, conn)
+		}()
+	}
+}
+
+// ServeConn answers the requests on conn until it's closed or ctx is done
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(nil, maxLine)
+	w := bufio.NewWriter(conn)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		res, err := s.Do(line)
+		if err == nil {
+			var b []byte
+			b, err = json.Marshal(res)
+			if err == nil {
+				fmt.Fprintf(w, "ok %s\n", b)
+			}
+		}
+		if err != nil {
+			msg := strings.ReplaceAll(err.Error(), "\n", " ")
+			fmt.Fprintf(w, "err %s\n", msg)
+		}
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// Do runs one request line and returns the result
+func (s *Server) Do(line string) (any, error) {
+	cmd, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	name, arg, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	arg = strings.TrimSpace(arg)
+
+	if cmd == "list" && name == "" {
+		return s.names(), nil
+	}
+
+	s.mtx.RLock()
+	c, ok := s.colls[name]
+	s.mtx.RUnlock()
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("admin: %s needs a collection name", cmd)
+	case !ok:
+		return nil, fmt.Errorf("admin: unknown collection %q", name)
+	}
+
+	switch cmd {
+	case "list":
+		return c.keys(), nil
+	case "get":
+		if arg == "" {
+			return nil, errors.New("admin: get needs a key")
+		}
+		return c.get(arg)
+	case "len":
+		return c.len(), nil
+	case "stats":
+		return c.stats(), nil
+	case "dump":
+		if arg == "" {
+			return nil, errors.New("admin: dump needs a file")
+		}
+		return c.dump(arg)
+	case "purge-deleted":
+		return c.purgeDeleted()
+	}
+	return nil, fmt.Errorf("admin: unknown command %q", cmd)
+}
+
+// names returns the registered collection names, sorted
+func (s *Server) names() []string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	names := make([]string, 0, len(s.colls))
+	for name := range s.colls {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+type adapter[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c    *syncmap.Collection[K, V]
+	opts Options[K, V]
+}
+
+func (a *adapter[K, V]) keys() []string {
+	keys := make([]string, 0, a.c.Len())
+	for k := range a.c.IterSnapshot() {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (a *adapter[K, V]) get(key string) (Entry, error) {
+	k, err := a.opts.ParseKey(key)
+	if err != nil {
+		return Entry{}, err
+	}
+	v, rev, ok := a.c.GetRev(k)
+	if !ok {
+		return Entry{}, syncmap.ErrNotFound
+	}
+	return Entry{Key: key, Rev: rev, Value: v}, nil
+}
+
+func (a *adapter[K, V]) len() int {
+	return a.c.Len()
+}
+
+func (a *adapter[K, V]) stats() Stats {
+	st := Stats{Len: a.c.Len(), Rev: a.c.Rev(), Deleted: -1}
+	if a.opts.IsDeleted != nil {
+		st.Deleted = 0
+		for _, v := range a.c.Iter() {
+			if a.opts.IsDeleted(v) {
+				st.Deleted++
+			}
+		}
+	}
+	return st
+}
+
+// dump writes to a temporary file next to file and renames it, returns
+// the size written
+func (a *adapter[K, V]) dump(file string) (n int64, err error) {
+	f, err := os.CreateTemp(filepath.Dir(file), ".dump-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	err = a.c.ExportJSONL(f, syncmap.SortedKeys())
+	if err != nil {
+		return 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+	err = os.Rename(f.Name(), file)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (a *adapter[K, V]) purgeDeleted() (int, error) {
+	if a.opts.IsDeleted == nil {
+		return 0, ErrNoPurge
+	}
+	return a.c.RemoveIf(func(_ K, v V) bool {
+		return a.opts.IsDeleted(v)
+	}), nil
+}
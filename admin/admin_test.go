@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/pkpowell/syncmap"
+)
+
+type host struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (h *host) GetID() string { return h.ID }
+func (h *host) Del(b bool)    { h.Deleted = b }
+
+func TestDo(t *testing.T) {
+	s := NewServer()
+	hosts := syncmap.NewCollection[string, *host]()
+	ports := syncmap.NewCollection[int, *host]()
+	hosts.Add("a", &host{ID: "a"})
+	ports.Add(80, &host{ID: "web"})
+
+	if err := Register(s, "hosts", hosts, Options[string, *host]{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(s, "hosts", hosts, Options[string, *host]{}); !errors.Is(err, ErrExists) {
+		t.Fatalf("got %v, want ErrExists", err)
+	}
+	if err := Register(s, "bad name", hosts, Options[string, *host]{}); err == nil {
+		t.Fatal("registered a name with a space")
+	}
+	err := Register(s, "ports", ports, Options[int, *host]{ParseKey: strconv.Atoi})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.Do("list")
+	if err != nil || len(res.([]string)) != 2 {
+		t.Fatalf("list: %v %v", res, err)
+	}
+	res, err = s.Do("get ports 80")
+	if err != nil || res.(Entry).Value.(*host).ID != "web" {
+		t.Fatalf("get: %v %v", res, err)
+	}
+
+	for _, tc := range []struct {
+		line string
+		want error
+	}{
+		{"get ports x", strconv.ErrSyntax},
+		{"get hosts b", syncmap.ErrNotFound},
+		{"purge-deleted hosts", ErrNoPurge},
+	} {
+		if _, err := s.Do(tc.line); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.line, err, tc.want)
+		}
+	}
+	for _, line := range []string{"len", "len nope", "get hosts", "dump hosts", "frobnicate hosts"} {
+		if _, err := s.Do(line); err == nil {
+			t.Errorf("%s: no error", line)
+		}
+	}
+
+	if st := hosts.Len(); st != 1 {
+		t.Fatal("collection changed")
+	}
+	s.Unregister("ports")
+	if _, err := s.Do("len ports"); err == nil {
+		t.Error("unregistered collection still served")
+	}
+}
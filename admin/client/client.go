@@ -0,0 +1,161 @@
+// Package client talks to an admin server over its Unix socket
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+	"github.com/pkpowell/syncmap/admin"
+)
+
+// RemoteError is an error reply of the server
+type RemoteError string
+
+func (e RemoteError) Error() string {
+	return string(e)
+}
+
+// Client sends requests one at a time, it's safe for concurrent use. After
+// a failed read or write, eg a timeout, the reply stream can't be trusted,
+// the connection is closed and every later request fails, Dial again
+type Client struct {
+	mtx  sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	err  error // the connection failed
+
+	// Timeout limits each request, none if 0
+	Timeout time.Duration
+}
+
+// Dial connects to the admin socket at path
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a raw request and returns the JSON result. A missing key is
+// returned as syncmap.ErrNotFound, other server errors as RemoteError
+func (c *Client) Do(cmd string, args ...string) (json.RawMessage, error) {
+	line := strings.Join(append([]string{cmd}, args...), " ")
+	if strings.ContainsAny(line, "\r\n") {
+		return nil, fmt.Errorf("client: line break in request %q", line)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.err != nil {
+		return nil, fmt.Errorf("client: connection broken: %w", c.err)
+	}
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	_, err := c.conn.Write([]byte(line + "\n"))
+	if err != nil {
+		return nil, c.fail(err)
+	}
+	reply, err := c.r.ReadString('\n')
+	if err != nil {
+		// a late reply would answer the next request
+		return nil, c.fail(err)
+	}
+
+	status, body, _ := strings.Cut(strings.TrimSuffix(reply, "\n"), " ")
+	switch status {
+	case "ok":
+		return json.RawMessage(body), nil
+	case "err":
+		if body == syncmap.ErrNotFound.Error() {
+			return nil, syncmap.ErrNotFound
+		}
+		return nil, RemoteError(body)
+	}
+	return nil, fmt.Errorf("client: malformed reply %q", reply)
+}
+
+// fail closes the connection after err, c.mtx must be locked
+func (c *Client) fail(err error) error {
+	c.err = err
+	c.conn.Close()
+	return err
+}
+
+// call runs a request and decodes the result into res
+func (c *Client) call(res any, cmd string, args ...string) error {
+	b, err := c.Do(cmd, args...)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, res)
+}
+
+// Collections returns the names of the registered collections
+func (c *Client) Collections() (names []string, err error) {
+	err = c.call(&names, "list")
+	return names, err
+}
+
+// Keys returns the keys of collection name, sorted
+func (c *Client) Keys(name string) (keys []string, err error) {
+	err = c.call(&keys, "list", name)
+	return keys, err
+}
+
+// Get decodes the value of key into val and returns its revision
+func (c *Client) Get(name, key string, val any) (rev uint64, err error) {
+	var e struct {
+		Rev   uint64          `json:"rev"`
+		Value json.RawMessage `json:"value"`
+	}
+	err = c.call(&e, "get", name, key)
+	if err != nil {
+		return 0, err
+	}
+	if val != nil {
+		err = json.Unmarshal(e.Value, val)
+	}
+	return e.Rev, err
+}
+
+// Len returns the number of entries of collection name
+func (c *Client) Len(name string) (n int, err error) {
+	err = c.call(&n, "len", name)
+	return n, err
+}
+
+func (c *Client) Stats(name string) (st admin.Stats, err error) {
+	err = c.call(&st, "stats", name)
+	return st, err
+}
+
+// Dump makes the server write collection name to file, a path on the
+// server's file system. Returns the size written
+func (c *Client) Dump(name, file string) (n int64, err error) {
+	if file == "" {
+		return 0, errors.New("client: no dump file")
+	}
+	err = c.call(&n, "dump", name, file)
+	return n, err
+}
+
+// PurgeDeleted removes the entries marked as deleted, returns the number removed
+func (c *Client) PurgeDeleted(name string) (n int, err error) {
+	err = c.call(&n, "purge-deleted", name)
+	return n, err
+}
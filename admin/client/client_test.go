@@ -0,0 +1,244 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+	"github.com/pkpowell/syncmap/admin"
+)
+
+type host struct {
+	ID      string `json:"id"`
+	Addr    string `json:"addr"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (h *host) GetID() string { return h.ID }
+func (h *host) Del(b bool)    { h.Deleted = b }
+
+// serve runs an admin server with a hosts collection on a socket in a
+// temp dir until the test ends
+func serve(t *testing.T) (c *syncmap.Collection[string, *host], path string) {
+	c = syncmap.NewCollection[string, *host]()
+	for i := range 5 {
+		k := fmt.Sprint("h", i)
+		c.Add(k, &host{ID: k, Addr: fmt.Sprint("10.0.0.", i)})
+	}
+
+	s := admin.NewServer()
+	err := admin.Register(s, "hosts", c, admin.Options[string, *host]{
+		IsDeleted: func(h *host) bool { return h.Deleted },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path = filepath.Join(t.TempDir(), "admin.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe(ctx, path)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket not created")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return c, path
+}
+
+func dial(t *testing.T, path string) *Client {
+	cl, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Timeout = 3 * time.Second
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func TestClient(t *testing.T) {
+	c, path := serve(t)
+	cl := dial(t, path)
+
+	names, err := cl.Collections()
+	if err != nil || fmt.Sprint(names) != "[hosts]" {
+		t.Fatalf("collections %v %v", names, err)
+	}
+	// requests are served after the chmod
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode %v %v", fi.Mode(), err)
+	}
+	keys, err := cl.Keys("hosts")
+	if err != nil || fmt.Sprint(keys) != "[h0 h1 h2 h3 h4]" {
+		t.Fatalf("keys %v %v", keys, err)
+	}
+
+	var h host
+	rev, err := cl.Get("hosts", "h3", &h)
+	if err != nil || h.Addr != "10.0.0.3" || rev != 4 {
+		t.Fatalf("get %+v rev %d: %v", h, rev, err)
+	}
+	if _, err := cl.Get("hosts", "nope", nil); !errors.Is(err, syncmap.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	var rerr RemoteError
+	if _, err := cl.Len("nope"); !errors.As(err, &rerr) {
+		t.Fatalf("got %v, want RemoteError", err)
+	}
+
+	c.Delete("h1")
+	c.Delete("h2")
+	st, err := cl.Stats("hosts")
+	if err != nil || st != (admin.Stats{Len: 5, Rev: 7, Deleted: 2}) {
+		t.Fatalf("stats %+v %v", st, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "hosts.jsonl")
+	size, err := cl.Dump("hosts", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, _ := f.Stat(); fi.Size() != size {
+		t.Errorf("dump reported %d bytes, file has %d", size, fi.Size())
+	}
+	var lines []host
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var h host
+		if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, h)
+	}
+	if len(lines) != 5 || lines[0].ID != "h0" || !lines[1].Deleted {
+		t.Errorf("dump %+v", lines)
+	}
+
+	n, err := cl.PurgeDeleted("hosts")
+	if err != nil || n != 2 {
+		t.Fatalf("purged %d: %v", n, err)
+	}
+	if n, err := cl.Len("hosts"); err != nil || n != 3 {
+		t.Fatalf("len %d: %v", n, err)
+	}
+	if c.Exists("h1") || c.Exists("h2") {
+		t.Error("deleted entries not purged")
+	}
+
+	// a second connection is served concurrently
+	if n, err := dial(t, path).Len("hosts"); err != nil || n != 3 {
+		t.Fatalf("second client len %d: %v", n, err)
+	}
+	if _, err := cl.Do("get", "hosts", "a\nb"); err == nil {
+		t.Error("sent a request with a line break")
+	}
+}
+
+func TestStaleSocket(t *testing.T) {
+	_, path := serve(t)
+
+	s := admin.NewServer()
+	if err := s.ListenAndServe(context.Background(), path); !errors.Is(err, admin.ErrInUse) {
+		t.Fatalf("got %v, want ErrInUse", err)
+	}
+
+	// a socket file left by a crashed server is replaced
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe(ctx, stale)
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		cl, err := Dial(stale)
+		if err == nil {
+			cl.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// answers every request, the first one too late
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for i := 1; sc.Scan(); i++ {
+			if i == 1 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			fmt.Fprintf(conn, "ok %d\n", i)
+		}
+	}()
+
+	cl, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	cl.Timeout = 20 * time.Millisecond
+
+	if _, err := cl.Len("hosts"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	n, err := cl.Len("hosts")
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got %d %v, want the timeout again", n, err)
+	}
+}
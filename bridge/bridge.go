@@ -0,0 +1,302 @@
+// Package bridge connects the change stream of a syncmap.Collection to an
+// external message bus, and applies the changes other nodes publish there.
+//
+// Every event carries the ID of the node it originated on, so a node
+// ignores its own events coming back, and an idempotency key so
+// duplicate deliveries are applied once.
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// ErrClosed is returned when the bridge stops delivering events
+var ErrClosed = errors.New("bridge: closed")
+
+// Event is a collection change on the bus
+type Event[K syncmap.MapKey, V any] struct {
+	ID     string `json:"id"`     // idempotency key, origin, epoch and revision of the change
+	Origin string `json:"origin"` // node the change was made on
+	Op     string `json:"op"`     // see syncmap.EventOp
+	Key    K      `json:"key"`
+	Value  V      `json:"value,omitempty"`
+	Rev    uint64 `json:"rev"` // collection revision on the origin
+}
+
+// Bridge is a message bus carrying events
+type Bridge[K syncmap.MapKey, V any] interface {
+	// Publish sends e to the subscribers
+	Publish(e Event[K, V]) error
+	// Subscribe delivers the published events until ctx is done
+	Subscribe(ctx context.Context) <-chan Event[K, V]
+}
+
+// Options configures Connect
+type Options struct {
+	// Origin identifies this node on the bus, random if empty
+	Origin string
+	// Buffer is the number of local changes queued for publishing, 256 if 0
+	Buffer int
+	// Dedup is the number of recent idempotency keys remembered, 4096 if 0
+	Dedup int
+	// OnError is called with events that can't be applied
+	OnError func(error)
+}
+
+// parseOp is the inverse of syncmap.EventOp.String
+func parseOp(s string) (syncmap.EventOp, error) {
+	for op := syncmap.OpAdd; op <= syncmap.OpReset; op++ {
+		if op.String() == s {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("bridge: unknown op %q", s)
+}
+
+// Connect publishes the changes of c to b and applies the events of other
+// origins from b to c until ctx is done or either side fails. Whole map
+// replacements, OpReset, aren't published
+func Connect[K syncmap.MapKey, V syncmap.MapValue](ctx context.Context, c *syncmap.Collection[K, V], b Bridge[K, V], opts Options) error {
+	if opts.Origin == "" {
+		var id [8]byte
+		rand.Read(id[:])
+		opts.Origin = hex.EncodeToString(id[:])
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 256
+	}
+	if opts.Dedup <= 0 {
+		opts.Dedup = 4096
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	l := &link[K, V]{
+		c:       c,
+		b:       b,
+		opts:    opts,
+		echoes:  make(map[K][]echo[V]),
+		seen:    make(map[string]struct{}, opts.Dedup),
+		history: make([]string, 0, opts.Dedup),
+	}
+
+	// subscribe before applying, so no local change is missed
+	sub := c.Subscribe(opts.Buffer)
+	defer sub.Close()
+	in := b.Subscribe(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cancel(l.inbound(ctx, in))
+	}()
+
+	cancel(l.outbound(ctx, sub))
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// echo is a change made by applying a remote event, its local event isn't
+// published again
+type echo[V any] struct {
+	op    syncmap.EventOp
+	value V
+}
+
+type link[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c    *syncmap.Collection[K, V]
+	b    Bridge[K, V]
+	opts Options
+
+	mtx    sync.Mutex
+	echoes map[K][]echo[V]
+
+	// idempotency keys, oldest first, only used by inbound
+	seen    map[string]struct{}
+	history []string
+}
+
+// outbound publishes the local changes. Revisions restart with every
+// collection, the epoch in the idempotency key keeps a restarted origin
+// from reusing the keys peers remember
+func (l *link[K, V]) outbound(ctx context.Context, sub *syncmap.Subscription[K, V]) error {
+	epoch := strconv.FormatUint(l.c.Epoch(), 16)
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case e, ok := <-sub.C:
+			if !ok {
+				return sub.Err()
+			}
+			if e.Op == syncmap.OpReset {
+				// a Restore starts another history
+				epoch = strconv.FormatUint(l.c.Epoch(), 16)
+				continue
+			}
+			if l.isEcho(e) {
+				continue
+			}
+			err := l.b.Publish(Event[K, V]{
+				ID:     l.opts.Origin + ":" + epoch + ":" + strconv.FormatUint(e.Rev, 10),
+				Origin: l.opts.Origin,
+				Op:     e.Op.String(),
+				Key:    e.Key,
+				Value:  e.Value,
+				Rev:    e.Rev,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (l *link[K, V]) inbound(ctx context.Context, in <-chan Event[K, V]) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case e, ok := <-in:
+			if !ok {
+				return ErrClosed
+			}
+			if e.Origin == l.opts.Origin || l.duplicate(e.ID) {
+				continue
+			}
+			err := l.apply(e)
+			if err != nil && l.opts.OnError != nil {
+				l.opts.OnError(err)
+			}
+		}
+	}
+}
+
+// duplicate records id and reports if it was seen recently
+func (l *link[K, V]) duplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	if _, ok := l.seen[id]; ok {
+		return true
+	}
+	if len(l.history) == cap(l.history) {
+		delete(l.seen, l.history[0])
+		l.history = append(l.history[:0], l.history[1:]...)
+	}
+	l.history = append(l.history, id)
+	l.seen[id] = struct{}{}
+	return false
+}
+
+// apply makes the change of e, expecting its local event. The expectation
+// is registered before the change and taken back if it changed nothing, so
+// a local change in between can't leave it behind
+func (l *link[K, V]) apply(e Event[K, V]) error {
+	op, err := parseOp(e.Op)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case syncmap.OpAdd, syncmap.OpUpdate:
+		x := echo[V]{op: syncmap.OpAdd, value: e.Value}
+		l.expect(e.Key, x)
+		if !l.c.Add(e.Key, e.Value) {
+			l.unexpect(e.Key, x)
+		}
+	case syncmap.OpRemove:
+		x := echo[V]{op: syncmap.OpRemove}
+		l.expect(e.Key, x)
+		err = l.c.RemoveCond(e.Key, nil)
+		if errors.Is(err, syncmap.ErrNotFound) {
+			l.unexpect(e.Key, x)
+			return nil
+		}
+		return err
+	case syncmap.OpDelete, syncmap.OpUndelete:
+		for {
+			// the event carries the marked value, it must not be replaced
+			// before the mark
+			v, rev, ok := l.c.GetRev(e.Key)
+			if !ok {
+				return fmt.Errorf("bridge: %s of missing key %v", op, e.Key)
+			}
+			x := echo[V]{op: op, value: v}
+			l.expect(e.Key, x)
+			if op == syncmap.OpDelete {
+				_, err = l.c.DeleteCond(e.Key, syncmap.MatchRev(rev))
+			} else {
+				_, err = l.c.UnDeleteCond(e.Key, syncmap.MatchRev(rev))
+			}
+			if err == nil {
+				return nil
+			}
+			l.unexpect(e.Key, x)
+			if !errors.Is(err, syncmap.ErrRevMismatch) && !errors.Is(err, syncmap.ErrNotFound) {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("bridge: can't apply %s", op)
+	}
+	return nil
+}
+
+func (l *link[K, V]) expect(k K, e echo[V]) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.echoes[k] = append(l.echoes[k], e)
+}
+
+// unexpect drops the latest expectation e of k, the apply changed nothing.
+// It's gone if a local change took it in the meantime
+func (l *link[K, V]) unexpect(k K, e echo[V]) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	xs := l.echoes[k]
+	for i := len(xs) - 1; i >= 0; i-- {
+		if xs[i] == e {
+			xs = append(xs[:i], xs[i+1:]...)
+			break
+		}
+	}
+	if len(xs) == 0 {
+		delete(l.echoes, k)
+	} else {
+		l.echoes[k] = xs
+	}
+}
+
+// isEcho reports if e was caused by applying a remote event
+func (l *link[K, V]) isEcho(e syncmap.Event[K, V]) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	op := e.Op
+	if op == syncmap.OpUpdate {
+		op = syncmap.OpAdd
+	}
+	for i, x := range l.echoes[e.Key] {
+		if x.op == op && x.value == e.Value {
+			l.echoes[e.Key] = append(l.echoes[e.Key][:i], l.echoes[e.Key][i+1:]...)
+			if len(l.echoes[e.Key]) == 0 {
+				delete(l.echoes, e.Key)
+			}
+			return true
+		}
+	}
+	return false
+}
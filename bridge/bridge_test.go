@@ -0,0 +1,247 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+type host struct {
+	ID      string `json:"id"`
+	Addr    string `json:"addr"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (h *host) GetID() string { return h.ID }
+func (h *host) Del(b bool)    { h.Deleted = b }
+
+// counting counts the events published through it
+type counting[K syncmap.MapKey, V any] struct {
+	Bridge[K, V]
+	n atomic.Int64
+}
+
+func (c *counting[K, V]) Publish(e Event[K, V]) error {
+	c.n.Add(1)
+	return c.Bridge.Publish(e)
+}
+
+// eventually polls cond until it holds or a few seconds passed
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// contents copies the values of c under its read lock
+func contents(c *syncmap.Collection[string, *host]) map[string]host {
+	m := make(map[string]host)
+	for k, v := range c.Iter() {
+		m[k] = *v
+	}
+	return m
+}
+
+func same(cs ...*syncmap.Collection[string, *host]) bool {
+	want := contents(cs[0])
+	for _, c := range cs[1:] {
+		if !reflect.DeepEqual(want, contents(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// connect runs Connect until the test ends
+func connect(t *testing.T, c *syncmap.Collection[string, *host], b Bridge[string, *host], origin string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Connect(ctx, c, b, Options{Origin: origin, OnError: func(err error) {
+			t.Error(err)
+		}})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// change makes 9 changes on c in phases, waiting for done after each. A
+// value marked in place mustn't be marked again before it's published
+func change(t *testing.T, c *syncmap.Collection[string, *host], prefix string, done func() bool) {
+	t.Helper()
+
+	for i := range 4 {
+		k := fmt.Sprint(prefix, i)
+		c.Add(k, &host{ID: k, Addr: fmt.Sprint("10.0.0.", i)})
+	}
+	c.Add(prefix+"0", &host{ID: prefix + "0", Addr: "10.0.1.0"})
+	eventually(t, "adds not applied", done)
+
+	c.Delete(prefix + "1")
+	c.Delete(prefix + "2")
+	eventually(t, "deletes not applied", done)
+
+	c.UnDelete(prefix + "2")
+	c.Remove(prefix + "3")
+	eventually(t, "remove not applied", done)
+}
+
+func TestChanBridge(t *testing.T) {
+	bus := &counting[string, *host]{Bridge: NewChanBridge[string, *host](1024)}
+
+	cs := make([]*syncmap.Collection[string, *host], 3)
+	for i := range cs {
+		cs[i] = syncmap.NewCollection[string, *host]()
+		connect(t, cs[i], bus, fmt.Sprint("node", i))
+	}
+	time.Sleep(10 * time.Millisecond) // let the subscriptions start
+
+	for i, c := range cs {
+		change(t, c, fmt.Sprint("n", i, "-"), func() bool {
+			return same(cs...)
+		})
+	}
+	if n := cs[0].Len(); n != 9 {
+		t.Fatalf("got %d keys, want 9", n)
+	}
+
+	// 9 local changes per node, the applied ones aren't published back
+	time.Sleep(20 * time.Millisecond)
+	if n := bus.n.Load(); n != 27 {
+		t.Errorf("published %d events, want 27", n)
+	}
+	v, _ := cs[2].Get("n0-1")
+	if !v.Deleted {
+		t.Error("delete not applied")
+	}
+	if _, ok := cs[1].Get("n2-3"); ok {
+		t.Error("remove not applied")
+	}
+	if b := bus.Bridge.(*ChanBridge[string, *host]); b.Dropped() != 0 {
+		t.Errorf("%d events dropped", b.Dropped())
+	}
+}
+
+func TestJSONBridge(t *testing.T) {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	t.Cleanup(func() {
+		ar.Close()
+		br.Close()
+	})
+
+	a := syncmap.NewCollection[string, *host]()
+	b := syncmap.NewCollection[string, *host]()
+	ab := &counting[string, *host]{Bridge: NewJSONBridge[string, *host](ar, aw)}
+	bb := &counting[string, *host]{Bridge: NewJSONBridge[string, *host](br, bw)}
+	connect(t, a, ab, "a")
+	connect(t, b, bb, "b")
+	time.Sleep(10 * time.Millisecond)
+
+	converged := func() bool {
+		return same(a, b)
+	}
+	change(t, a, "a", converged)
+	change(t, b, "b", converged)
+	if n := a.Len(); n != 6 {
+		t.Fatalf("got %d keys, want 6", n)
+	}
+	if v, _ := b.Get("a0"); v.Addr != "10.0.1.0" {
+		t.Errorf("update not applied, got %+v", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if n, m := ab.n.Load(), bb.n.Load(); n != 9 || m != 9 {
+		t.Errorf("published %d and %d events, want 9 each", n, m)
+	}
+}
+
+func TestConnectDedup(t *testing.T) {
+	bus := NewChanBridge[string, *host](16)
+	c := syncmap.NewCollection[string, *host]()
+	connect(t, c, bus, "local")
+	time.Sleep(10 * time.Millisecond)
+
+	add := Event[string, *host]{ID: "remote:1", Origin: "remote", Op: "add", Key: "h", Value: &host{ID: "h"}, Rev: 1}
+	bus.Publish(add)
+	bus.Publish(Event[string, *host]{ID: "remote:2", Origin: "remote", Op: "remove", Key: "h", Rev: 2})
+	bus.Publish(add) // redelivered
+	// our own event coming back
+	bus.Publish(Event[string, *host]{ID: "local:1", Origin: "local", Op: "add", Key: "own", Value: &host{ID: "own"}, Rev: 1})
+	bus.Publish(Event[string, *host]{ID: "remote:3", Origin: "remote", Op: "add", Key: "last", Value: &host{ID: "last"}, Rev: 3})
+
+	eventually(t, "last event not applied", func() bool {
+		return c.Exists("last")
+	})
+	if c.Exists("h") {
+		t.Error("redelivered add applied again")
+	}
+	if c.Exists("own") {
+		t.Error("event of own origin applied")
+	}
+}
+
+func TestConnectRestart(t *testing.T) {
+	bus := NewChanBridge[string, *host](16)
+	peer := syncmap.NewCollection[string, *host]()
+	connect(t, peer, bus, "peer")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	a := syncmap.NewCollection[string, *host]()
+	go func() { done <- Connect(ctx, a, bus, Options{Origin: "a"}) }()
+	time.Sleep(10 * time.Millisecond)
+	a.Add("x", &host{ID: "x"})
+	eventually(t, "x not applied", func() bool { return peer.Exists("x") })
+	cancel()
+	<-done
+
+	// restarted with the same origin, its revisions start over
+	a = syncmap.NewCollection[string, *host]()
+	connect(t, a, bus, "a")
+	time.Sleep(10 * time.Millisecond)
+	a.Add("y", &host{ID: "y"})
+	eventually(t, "change after restart dropped as a duplicate", func() bool { return peer.Exists("y") })
+}
+
+func TestApplyRemoveRace(t *testing.T) {
+	c := syncmap.NewCollection[string, *host]()
+	l := &link[string, *host]{c: c, echoes: make(map[string][]echo[*host])}
+	c.Add("k", &host{ID: "k"})
+	sub := c.Subscribe(1)
+	defer sub.Close()
+
+	// hold apply at its expectation while the key is removed locally
+	l.mtx.Lock()
+	applied := make(chan error, 1)
+	go func() {
+		applied <- l.apply(Event[string, *host]{Op: "remove", Key: "k"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Remove("k")
+	l.mtx.Unlock()
+	if err := <-applied; err != nil {
+		t.Fatal(err)
+	}
+
+	if l.isEcho(<-sub.C) {
+		t.Fatal("local remove taken for an echo")
+	}
+	if len(l.echoes) != 0 {
+		t.Fatalf("stale expectations %v", l.echoes)
+	}
+}
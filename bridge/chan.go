@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// ///////////////////////////
+// In-process bus
+// ///////////////////////////
+
+// ChanBridge is an in-process Bridge, every subscriber gets every event.
+// Events are copied through JSON like on a real bus, so collections never
+// share values. Publish doesn't block, events for a subscriber with a
+// full buffer are dropped and counted
+type ChanBridge[K syncmap.MapKey, V any] struct {
+	buf     int
+	dropped atomic.Uint64
+
+	mtx  sync.Mutex
+	subs map[chan Event[K, V]]struct{}
+}
+
+// NewChanBridge creates a bus buffering up to buf events per subscriber
+func NewChanBridge[K syncmap.MapKey, V any](buf int) *ChanBridge[K, V] {
+	return &ChanBridge[K, V]{buf: buf, subs: make(map[chan Event[K, V]]struct{})}
+}
+
+// Publish sends e to the current subscribers
+func (b *ChanBridge[K, V]) Publish(e Event[K, V]) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for ch := range b.subs {
+		var c Event[K, V]
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		select {
+		case ch <- c:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers the events published from now until ctx is done
+func (b *ChanBridge[K, V]) Subscribe(ctx context.Context) <-chan Event[K, V] {
+	ch := make(chan Event[K, V], b.buf)
+
+	b.mtx.Lock()
+	b.subs[ch] = struct{}{}
+	b.mtx.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+
+		delete(b.subs, ch)
+		close(ch)
+	})
+	return ch
+}
+
+// Dropped returns the number of events dropped for slow subscribers
+func (b *ChanBridge[_, _]) Dropped() uint64 {
+	return b.dropped.Load()
+}
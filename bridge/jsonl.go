@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// ///////////////////////////
+// JSON lines bus
+// ///////////////////////////
+
+// maxLine caps the size of one received event
+const maxLine = 16 << 20
+
+// JSONBridge is a Bridge writing events as JSON lines to w and reading
+// them from r, eg the ends of two io.Pipes or a socket. Reading starts
+// with the first Subscribe and blocks the subscribers, close r to stop it
+type JSONBridge[K syncmap.MapKey, V any] struct {
+	r io.Reader
+
+	wmtx sync.Mutex
+	enc  *json.Encoder
+
+	once sync.Once
+	mtx  sync.Mutex
+	subs map[*jsonSub[K, V]]struct{}
+	err  error // read error, set when reading stopped
+	done bool
+}
+
+type jsonSub[K syncmap.MapKey, V any] struct {
+	mtx    sync.Mutex // held while sending, so ch isn't closed under it
+	ch     chan Event[K, V]
+	done   <-chan struct{}
+	closed bool
+}
+
+func (s *jsonSub[K, V]) send(e Event[K, V]) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- e:
+	case <-s.done:
+	}
+}
+
+func (s *jsonSub[K, V]) close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// NewJSONBridge creates a bus reading events from r and writing to w
+func NewJSONBridge[K syncmap.MapKey, V any](r io.Reader, w io.Writer) *JSONBridge[K, V] {
+	return &JSONBridge[K, V]{
+		r:    r,
+		enc:  json.NewEncoder(w),
+		subs: make(map[*jsonSub[K, V]]struct{}),
+	}
+}
+
+// Publish writes e as one line
+func (b *JSONBridge[K, V]) Publish(e Event[K, V]) error {
+	b.wmtx.Lock()
+	defer b.wmtx.Unlock()
+
+	return b.enc.Encode(e)
+}
+
+// Subscribe delivers the events read until ctx is done or reading stops
+func (b *JSONBridge[K, V]) Subscribe(ctx context.Context) <-chan Event[K, V] {
+	s := &jsonSub[K, V]{ch: make(chan Event[K, V]), done: ctx.Done()}
+
+	b.mtx.Lock()
+	if b.done {
+		s.close()
+	} else {
+		b.subs[s] = struct{}{}
+	}
+	b.mtx.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		b.mtx.Lock()
+		delete(b.subs, s)
+		b.mtx.Unlock()
+		s.close()
+	})
+	b.once.Do(func() {
+		go b.read()
+	})
+	return s.ch
+}
+
+// Err returns the error that stopped reading, nil while reading or at EOF
+func (b *JSONBridge[_, _]) Err() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.err
+}
+
+func (b *JSONBridge[K, V]) read() {
+	sc := bufio.NewScanner(b.r)
+	sc.Buffer(nil, maxLine)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Event[K, V]
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			b.stop(err)
+			return
+		}
+		b.deliver(e)
+	}
+	b.stop(sc.Err())
+}
+
+// deliver hands e to every subscriber, waiting for each unless its
+// context is done
+func (b *JSONBridge[K, V]) deliver(e Event[K, V]) {
+	b.mtx.Lock()
+	subs := make([]*jsonSub[K, V], 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mtx.Unlock()
+
+	for _, s := range subs {
+		s.send(e)
+	}
+}
+
+func (b *JSONBridge[K, V]) stop(err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.err, b.done = err, true
+	for s := range b.subs {
+		delete(b.subs, s)
+		s.close()
+	}
+}
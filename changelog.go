@@ -0,0 +1,81 @@
+package syncmap
+
+// ///////////////////////////
+// Change log
+// ///////////////////////////
+
+// changeLog is a ring of the most recent events, oldest first
+type changeLog[K MapKey, V MapValue] struct {
+	buf   []Event[K, V]
+	start int // index of the oldest event
+	n     int
+}
+
+func newChangeLog[K MapKey, V MapValue](size int) *changeLog[K, V] {
+	return &changeLog[K, V]{buf: make([]Event[K, V], size)}
+}
+
+func (l *changeLog[K, V]) append(e Event[K, V]) {
+	if l.n < len(l.buf) {
+		l.buf[(l.start+l.n)%len(l.buf)] = e
+		l.n++
+		return
+	}
+	l.buf[l.start] = e
+	l.start = (l.start + 1) % len(l.buf)
+}
+
+// since returns the events after rev, ok is false if some were already dropped
+func (l *changeLog[K, V]) since(rev, cur uint64) (events []Event[K, V], ok bool) {
+	if rev >= cur {
+		return nil, true
+	}
+	if l.n == 0 || l.buf[l.start].Rev > rev+1 {
+		return nil, false
+	}
+	for i := range l.n {
+		e := l.buf[(l.start+i)%len(l.buf)]
+		if e.Rev > rev {
+			events = append(events, e)
+		}
+	}
+	return events, true
+}
+
+// publish records e in the change log and sends it to subscribers, c.mtx must be write locked
+func (c *Collection[K, V]) publish(e Event[K, V]) {
+	if c.log != nil {
+		c.log.append(e)
+	}
+	c.events.emit(e)
+}
+
+// SubscribeSnapshot copies the collection and subscribes to the changes
+// after it in one step, rev is the revision of the copy
+func (c *Collection[K, V]) SubscribeSnapshot(buf int) (snap map[K]V, rev uint64, sub *Subscription[K, V]) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	snap = make(map[K]V, len(c.m))
+	for k, v := range c.m {
+		snap[k] = v
+	}
+	return snap, c.rev, c.events.subscribe(buf)
+}
+
+// SubscribeSince returns the logged events after rev and subscribes to the
+// following ones in one step. ok is false if the collection has no change
+// log or rev is older than the log, use SubscribeSnapshot instead
+func (c *Collection[K, V]) SubscribeSince(rev uint64, buf int) (missed []Event[K, V], sub *Subscription[K, V], ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if c.log == nil || rev > c.rev {
+		return nil, nil, false
+	}
+	missed, ok = c.log.since(rev, c.rev)
+	if !ok {
+		return nil, nil, false
+	}
+	return missed, c.events.subscribe(buf), true
+}
@@ -0,0 +1,58 @@
+package syncmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSubscribeSince(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID](WithChangeLog(4))
+	for i := range 6 {
+		k := fmt.Sprint(i)
+		col.Add(k, &ZTPeerID{Address: k})
+	}
+
+	missed, sub, ok := col.SubscribeSince(3, 10)
+	if !ok {
+		t.Fatal("rev 3 not in the log")
+	}
+	defer sub.Close()
+	if len(missed) != 3 || missed[0].Rev != 4 || missed[2].Key != "5" {
+		t.Fatalf("unexpected missed events %+v", missed)
+	}
+
+	col.Remove("0")
+	e := <-sub.C
+	if e.Op != OpRemove || e.Rev != 7 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	// revs 1 and 2 were dropped from the ring
+	if _, _, ok := col.SubscribeSince(1, 10); ok {
+		t.Fatal("rev 1 should be too old")
+	}
+	if missed, sub, ok := col.SubscribeSince(col.Rev(), 10); !ok || len(missed) != 0 {
+		t.Fatal("current rev should resume with nothing missed")
+	} else {
+		sub.Close()
+	}
+	if _, _, ok := NewCollection[string, *ZTPeerID]().SubscribeSince(0, 10); ok {
+		t.Fatal("no change log")
+	}
+}
+
+func TestSubscribeSnapshot(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID]()
+	col.Add("a", &ZTPeerID{Address: "a"})
+
+	snap, rev, sub := col.SubscribeSnapshot(10)
+	defer sub.Close()
+	if len(snap) != 1 || rev != 1 {
+		t.Fatalf("snapshot %v at rev %d", snap, rev)
+	}
+
+	col.Add("b", &ZTPeerID{Address: "b"})
+	if e := <-sub.C; e.Key != "b" || e.Rev != rev+1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
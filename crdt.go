@@ -0,0 +1,192 @@
+package syncmap
+
+import (
+	"iter"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ///////////////////////////
+// CRDT Collection
+// ///////////////////////////
+
+// Register is a last writer wins register, the write with the greatest
+// Stamp wins. Deleted registers are tombstones, their value is marked
+// with Del(true) and they are kept so the delete wins over older writes
+type Register[V any] struct {
+	Value   V    `json:"value" cbor:"v"`
+	Stamp   HLC  `json:"stamp" cbor:"s"`
+	Deleted bool `json:"deleted,omitempty" cbor:"d,omitempty"`
+}
+
+// CRDTCollection is a map of LWW registers that replicas edit independently
+// and combine with Merge. Merging is commutative, associative and
+// idempotent, so replicas that saw the same writes hold the same state
+// regardless of merge order
+type CRDTCollection[K MapKey, V MapValue] struct {
+	mtx   *rwMutex
+	m     map[K]Register[V]
+	clock *Clock
+}
+
+// NewCRDTCollection creates new empty m: map[K]Register[V] for node, node
+// must be unique among the replicas
+func NewCRDTCollection[K MapKey, V MapValue](node string) *CRDTCollection[K, V] {
+	var c CRDTCollection[K, V]
+	return newCRDTCollection(&c, node)
+}
+
+func newCRDTCollection[K MapKey, V MapValue](c *CRDTCollection[K, V], node string) *CRDTCollection[K, V] {
+	c.mtx = newRWMutex()
+	c.m = make(map[K]Register[V])
+	c.clock = NewClock(node)
+	return c
+}
+
+// Exists check if key exists, tombstones included
+func (c *CRDTCollection[K, _]) Exists(key K) (ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	_, ok = c.m[key]
+	return ok
+}
+
+// Get val with key, tombstones included
+func (c *CRDTCollection[K, V]) Get(key K) (val V, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	r, ok := c.m[key]
+	return r.Value, ok
+}
+
+// GetRegister gets the register of key
+func (c *CRDTCollection[K, V]) GetRegister(key K) (r Register[V], ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	r, ok = c.m[key]
+	return r, ok
+}
+
+// Add key / val to map, stamped with the node clock
+func (c *CRDTCollection[K, V]) Add(k K, v V) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.m[k] = Register[V]{Value: v, Stamp: c.clock.Now()}
+}
+
+// Delete marks key as deleted, leaving a tombstone. The value is copied
+// through CBOR before Del(true) so values shared with other replicas
+// aren't modified
+func (c *CRDTCollection[K, _]) Delete(key K) error {
+	return c.mark(key, true)
+}
+
+// UnDelete marks key as not deleted
+func (c *CRDTCollection[K, _]) UnDelete(key K) error {
+	return c.mark(key, false)
+}
+
+func (c *CRDTCollection[K, V]) mark(key K, deleted bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	r, ok := c.m[key]
+	if !ok {
+		return ErrNotFound
+	}
+	v, err := cloneValue(r.Value)
+	if err != nil {
+		return err
+	}
+	v.Del(deleted)
+	c.m[key] = Register[V]{Value: v, Stamp: c.clock.Now(), Deleted: deleted}
+	return nil
+}
+
+// cloneValue deep copies v by a CBOR round trip
+func cloneValue[V any](v V) (clone V, err error) {
+	b, err := canonicalEnc.Marshal(v)
+	if err != nil {
+		return clone, err
+	}
+	err = cbor.Unmarshal(b, &clone)
+	return clone, err
+}
+
+// State returns a copy of all registers, for MergeState on another replica
+func (c *CRDTCollection[K, V]) State() map[K]Register[V] {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	m := make(map[K]Register[V], len(c.m))
+	for k, r := range c.m {
+		m[k] = r
+	}
+	return m
+}
+
+// Merge takes the newer registers of other, returns the number of keys changed
+func (c *CRDTCollection[K, V]) Merge(other *CRDTCollection[K, V]) (changed int) {
+	if other == c {
+		return 0
+	}
+	return c.MergeState(other.State())
+}
+
+// MergeState takes the newer registers of state, returns the number of
+// keys changed. The node clock is advanced past the merged stamps
+func (c *CRDTCollection[K, V]) MergeState(state map[K]Register[V]) (changed int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var latest HLC
+	for k, r := range state {
+		if r.Stamp.Compare(latest) > 0 {
+			latest = r.Stamp
+		}
+		cur, ok := c.m[k]
+		if ok && r.Stamp.Compare(cur.Stamp) <= 0 {
+			continue
+		}
+		c.m[k] = r
+		changed++
+	}
+	if len(state) > 0 {
+		c.clock.Observe(latest)
+	}
+	return changed
+}
+
+// Len of map, tombstones included
+func (c *CRDTCollection[_, _]) Len() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return len(c.m)
+}
+
+func (c *CRDTCollection[_, _]) LenStr() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return strconv.Itoa(len(c.m))
+}
+
+// Iter iterates over all elements of K, tombstones included
+func (c *CRDTCollection[K, V]) Iter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mtx.RLock()
+		defer c.mtx.RUnlock()
+
+		for k, r := range c.m {
+			if !yield(k, r.Value) {
+				return
+			}
+		}
+	}
+}
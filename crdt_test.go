@@ -0,0 +1,201 @@
+package syncmap
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+type crdtItem struct {
+	Name    string `cbor:"name"`
+	Deleted bool   `cbor:"deleted"`
+}
+
+func (i *crdtItem) GetID() string { return i.Name }
+func (i *crdtItem) Del(b bool)    { i.Deleted = b }
+
+// fakeClock makes c tick 1ms per read from start
+func fakeClock(c *Clock, start int64) {
+	t := start
+	c.now = func() int64 {
+		t += 1e6
+		return t
+	}
+}
+
+func TestHLC(t *testing.T) {
+	c := NewClock("a")
+	c.now = func() int64 { return 100 }
+
+	a := c.Now()
+	b := c.Now()
+	if b.Compare(a) <= 0 || b.Wall != 100 || b.Logical != 1 {
+		t.Fatalf("%v not after %v", b, a)
+	}
+
+	// a remote clock ahead of ours
+	remote := HLC{Wall: 500, Logical: 7, Node: "b"}
+	c.Observe(remote)
+	if n := c.Now(); n.Compare(remote) <= 0 || n.Node != "a" {
+		t.Fatalf("%v not after %v", n, remote)
+	}
+
+	// time going backwards
+	c.now = func() int64 { return 1 }
+	prev := c.Now()
+	if n := c.Now(); n.Compare(prev) <= 0 {
+		t.Fatalf("%v not after %v", n, prev)
+	}
+}
+
+func TestCRDTDelete(t *testing.T) {
+	a := NewCRDTCollection[string, *crdtItem]("a")
+	b := NewCRDTCollection[string, *crdtItem]("b")
+	fakeClock(a.clock, 0)
+	fakeClock(b.clock, 0)
+
+	if err := a.Delete("x"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	a.Add("x", &crdtItem{Name: "x"})
+	b.Merge(a)
+	shared, _ := b.Get("x")
+
+	if err := b.Delete("x"); err != nil {
+		t.Fatal(err)
+	}
+	if shared.Deleted {
+		t.Fatal("delete modified the value shared with a")
+	}
+	a.Merge(b)
+	if v, _ := a.Get("x"); !v.Deleted {
+		t.Fatal("tombstone not merged")
+	}
+
+	// b's tombstone is newer than a's old write
+	old := a.State()
+	old["x"] = Register[*crdtItem]{Value: &crdtItem{Name: "x"}, Stamp: HLC{Wall: 1, Node: "a"}}
+	if b.MergeState(old) != 0 {
+		t.Fatal("old write resurrected the key")
+	}
+
+	// a write after the delete wins
+	a.Add("x", &crdtItem{Name: "x2"})
+	b.Merge(a)
+	if r, _ := b.GetRegister("x"); r.Deleted || r.Value.Name != "x2" {
+		t.Fatalf("unexpected register %+v", r)
+	}
+	if err := b.UnDelete("x"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// randomReplica applies n random operations on a few keys
+func randomReplica(rng *rand.Rand, node string, n int) *CRDTCollection[string, *crdtItem] {
+	c := NewCRDTCollection[string, *crdtItem](node)
+	// skewed clocks
+	fakeClock(c.clock, rng.Int64N(1e9))
+	for range n {
+		k := fmt.Sprint("k", rng.IntN(8))
+		if rng.IntN(4) == 0 {
+			c.Delete(k)
+			continue
+		}
+		c.Add(k, &crdtItem{Name: fmt.Sprint(node, rng.IntN(100))})
+	}
+	return c
+}
+
+func merged(node string, cs ...*CRDTCollection[string, *crdtItem]) map[string]Register[*crdtItem] {
+	m := NewCRDTCollection[string, *crdtItem](node)
+	for _, c := range cs {
+		m.Merge(c)
+	}
+	return m.State()
+}
+
+func TestCRDTMergeProperties(t *testing.T) {
+	prop := func(seed uint64) bool {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		a := randomReplica(rng, "a", rng.IntN(20))
+		b := randomReplica(rng, "b", rng.IntN(20))
+		c := randomReplica(rng, "c", rng.IntN(20))
+
+		// commutative
+		if !reflect.DeepEqual(merged("x", a, b), merged("x", b, a)) {
+			t.Log("not commutative")
+			return false
+		}
+
+		// associative
+		ab := NewCRDTCollection[string, *crdtItem]("ab")
+		ab.Merge(a)
+		ab.Merge(b)
+		bc := NewCRDTCollection[string, *crdtItem]("bc")
+		bc.Merge(b)
+		bc.Merge(c)
+		if !reflect.DeepEqual(merged("x", ab, c), merged("x", a, bc)) {
+			t.Log("not associative")
+			return false
+		}
+
+		// idempotent
+		before := a.State()
+		if a.Merge(a) != 0 || a.MergeState(before) != 0 || !reflect.DeepEqual(a.State(), before) {
+			t.Log("not idempotent")
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCRDTConvergence(t *testing.T) {
+	prop := func(seed uint64) bool {
+		rng := rand.New(rand.NewPCG(seed, 1))
+		replicas := make([]*CRDTCollection[string, *crdtItem], 4)
+		for i := range replicas {
+			replicas[i] = randomReplica(rng, fmt.Sprint("n", i), 0)
+		}
+
+		// interleave edits and pairwise merges in random order
+		for range 200 {
+			r := replicas[rng.IntN(len(replicas))]
+			k := fmt.Sprint("k", rng.IntN(8))
+			switch rng.IntN(4) {
+			case 0:
+				r.Delete(k)
+			case 1:
+				r.Merge(replicas[rng.IntN(len(replicas))])
+			default:
+				r.Add(k, &crdtItem{Name: fmt.Sprint(rng.IntN(100))})
+			}
+		}
+
+		// everyone merges everyone, in a random order
+		for _, i := range rng.Perm(len(replicas)) {
+			for _, j := range rng.Perm(len(replicas)) {
+				replicas[i].Merge(replicas[j])
+			}
+		}
+		for _, i := range rng.Perm(len(replicas)) {
+			replicas[0].Merge(replicas[i])
+		}
+		for _, r := range replicas[1:] {
+			r.Merge(replicas[0])
+			if !reflect.DeepEqual(r.State(), replicas[0].State()) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(prop, &quick.Config{MaxCount: 100}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+package syncmap
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ///////////////////////////
+// Diff
+// ///////////////////////////
+
+// FieldChange is one changed struct field, Path is dotted for nested structs
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  any    `json:"old"`
+	New  any    `json:"new"`
+}
+
+func (f FieldChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", f.Path, f.Old, f.New)
+}
+
+// Modified is a key present on both sides with different values
+type Modified[K MapKey, V any] struct {
+	Key    K             `json:"key"`
+	Old    V             `json:"old"`
+	New    V             `json:"new"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// DiffResult lists the keys added, removed and modified going from a to b.
+// Keys are sorted by their formatted value
+type DiffResult[K MapKey, V any] struct {
+	Added    []K              `json:"added"`
+	Removed  []K              `json:"removed"`
+	Modified []Modified[K, V] `json:"modified"`
+}
+
+// Empty reports if a and b were equal
+func (r DiffResult[_, _]) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Modified) == 0
+}
+
+// String renders the result one key per line, prefixed with +, - or ~
+func (r DiffResult[K, V]) String() string {
+	var b bytes.Buffer
+	for _, k := range r.Added {
+		fmt.Fprintf(&b, "+ %v\n", k)
+	}
+	for _, k := range r.Removed {
+		fmt.Fprintf(&b, "- %v\n", k)
+	}
+	for _, m := range r.Modified {
+		fmt.Fprintf(&b, "~ %v\n", m.Key)
+		for _, f := range m.Fields {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+	}
+	return b.String()
+}
+
+// DiffOptions configures DiffWith
+type DiffOptions[V any] struct {
+	// Equal compares values, defaults to Equaler or reflect.DeepEqual.
+	// Use DigestEqual to compare canonical CBOR digests
+	Equal func(a, b V) bool
+	// Fields fills Modified.Fields for struct values
+	Fields bool
+}
+
+// Diff compares a and b with the default equality
+func Diff[K MapKey, V any](a, b ReadOnlyCollection[K, V]) DiffResult[K, V] {
+	return DiffWith(a, b, DiffOptions[V]{})
+}
+
+// DiffWith compares a and b. Only one collection is locked at a time
+func DiffWith[K MapKey, V any](a, b ReadOnlyCollection[K, V], opts DiffOptions[V]) (r DiffResult[K, V]) {
+	equal := opts.Equal
+	if equal == nil {
+		equal = defaultEqual[V]()
+	}
+
+	old := make(map[K]V, a.Len())
+	for k, v := range a.Iter() {
+		old[k] = v
+	}
+
+	for k, v := range b.Iter() {
+		o, ok := old[k]
+		if !ok {
+			r.Added = append(r.Added, k)
+			continue
+		}
+		delete(old, k)
+
+		if equal(o, v) {
+			continue
+		}
+		m := Modified[K, V]{Key: k, Old: o, New: v}
+		if opts.Fields {
+			m.Fields = FieldDiff(o, v)
+		}
+		r.Modified = append(r.Modified, m)
+	}
+	for k := range old {
+		r.Removed = append(r.Removed, k)
+	}
+
+	slices.SortFunc(r.Added, compareKeys)
+	slices.SortFunc(r.Removed, compareKeys)
+	slices.SortFunc(r.Modified, func(a, b Modified[K, V]) int {
+		return compareKeys(a.Key, b.Key)
+	})
+	return r
+}
+
+// compareKeys orders keys by their formatted value
+func compareKeys[K MapKey](a, b K) int {
+	return cmp.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// DigestEqual compares the canonical CBOR digests of a and b
+func DigestEqual[V any](a, b V) bool {
+	da, err := ComputeDigest(a)
+	if err != nil {
+		return false
+	}
+	db, err := ComputeDigest(b)
+	if err != nil {
+		return false
+	}
+	return da == db
+}
+
+// FieldDiff lists the exported fields that differ between two structs or
+// pointers to structs. Nested structs are compared field by field, other
+// values with reflect.DeepEqual
+func FieldDiff(a, b any) []FieldChange {
+	var changes []FieldChange
+	fieldDiff("", reflect.ValueOf(a), reflect.ValueOf(b), &changes)
+	return changes
+}
+
+func fieldDiff(path string, a, b reflect.Value, changes *[]FieldChange) {
+	for a.Kind() == reflect.Pointer && b.Kind() == reflect.Pointer && !a.IsNil() && !b.IsNil() {
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if !a.IsValid() && !b.IsValid() {
+		return
+	}
+	if !a.IsValid() || !b.IsValid() || a.Kind() != reflect.Struct || a.Type() != b.Type() {
+		if !a.IsValid() || !b.IsValid() || !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changes = append(*changes, FieldChange{Path: path, Old: valueOf(a), New: valueOf(b)})
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		p := f.Name
+		if path != "" {
+			p = path + "." + f.Name
+		}
+		fieldDiff(p, a.Field(i), b.Field(i), changes)
+	}
+}
+
+func valueOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// ReadOnlyMap wraps a plain map, for diffing against snapshots
+func ReadOnlyMap[K MapKey, V any](m map[K]V) ReadOnlyCollection[K, V] {
+	return mapView[K, V](m)
+}
+
+// Snapshot returns a read only copy of the collection. Pointer values
+// are shared, not deep copied
+func (c *Collection[K, V]) Snapshot() ReadOnlyCollection[K, V] {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	m := make(mapView[K, V], len(c.m))
+	for k, v := range c.m {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,56 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	yesterday := NewCollection[string, *ZTNetwork]()
+	yesterday.Add("a", &ZTNetwork{NWID: "a", MTU: 2800})
+	yesterday.Add("b", &ZTNetwork{NWID: "b", MTU: 2800})
+	yesterday.Add("c", &ZTNetwork{NWID: "c", MTU: 2800, V6AssignMode: V6AssignMode{ZT: true}})
+
+	today := NewCollection[string, *ZTNetwork]()
+	today.Add("a", &ZTNetwork{NWID: "a", MTU: 2800})
+	today.Add("c", &ZTNetwork{NWID: "c", MTU: 1400})
+	today.Add("d", &ZTNetwork{NWID: "d"})
+
+	r := DiffWith(yesterday.Snapshot(), today, DiffOptions[*ZTNetwork]{Fields: true})
+
+	if len(r.Added) != 1 || r.Added[0] != "d" {
+		t.Fatalf("added %v", r.Added)
+	}
+	if len(r.Removed) != 1 || r.Removed[0] != "b" {
+		t.Fatalf("removed %v", r.Removed)
+	}
+	if len(r.Modified) != 1 || r.Modified[0].Key != "c" {
+		t.Fatalf("modified %v", r.Modified)
+	}
+
+	text := r.String()
+	for _, want := range []string{"+ d", "- b", "~ c", "MTU: 2800 -> 1400", "V6AssignMode.ZT: true -> false"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text diff missing %q:\n%s", want, text)
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"path":"MTU","old":2800,"new":1400`) {
+		t.Fatalf("unexpected json %s", b)
+	}
+}
+
+func TestDiffDigestEqual(t *testing.T) {
+	a := ReadOnlyMap(map[string]*ZTNetwork{"a": {NWID: "a", Tags: Tags{"x"}}})
+	b := ReadOnlyMap(map[string]*ZTNetwork{"a": {NWID: "a", Tags: Tags{"x"}}})
+
+	r := DiffWith(a, b, DiffOptions[*ZTNetwork]{Equal: DigestEqual[*ZTNetwork]})
+	if !r.Empty() {
+		t.Fatalf("expected no changes, got\n%s", r)
+	}
+}
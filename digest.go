@@ -0,0 +1,85 @@
+package syncmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ///////////////////////////
+// Content digests
+// ///////////////////////////
+
+// Digest is the SHA-256 of a value's canonical CBOR encoding
+type Digest [sha256.Size]byte
+
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// canonicalEnc encodes with Core Deterministic Encoding (RFC 8949 4.2.1) so
+// equal content always gives the same bytes, regardless of map order
+var canonicalEnc, _ = cbor.CoreDetEncOptions().EncMode()
+
+// ComputeDigest returns the content digest of v. Pointers are followed,
+// so two pointers to equal content have the same digest
+func ComputeDigest(v any) (d Digest, err error) {
+	b, err := canonicalEnc.Marshal(v)
+	if err != nil {
+		return d, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+// storeDigest updates the digest of key and reports if it was unchanged.
+// Values that can't be encoded are always treated as changed. c.mtx must be write locked
+func (c *Collection[K, V]) storeDigest(k K, v V) (same bool) {
+	old, ok := c.digests[k]
+	d, err := ComputeDigest(v)
+	if err != nil {
+		c.dropDigest(k)
+		return false
+	}
+	c.digests[k] = d
+	if c.tree != nil && (!ok || old != d) {
+		if ok {
+			c.tree.remove(k, old)
+		}
+		c.tree.add(k, d)
+	}
+	return ok && old == d
+}
+
+// dropDigest forgets the digest of key, c.mtx must be write locked
+func (c *Collection[K, V]) dropDigest(k K) {
+	d, ok := c.digests[k]
+	if !ok {
+		return
+	}
+	delete(c.digests, k)
+	if c.tree != nil {
+		c.tree.remove(k, d)
+	}
+}
+
+// resetDigests recomputes all digests, c.mtx must be write locked
+func (c *Collection[K, V]) resetDigests() {
+	clear(c.digests)
+	if c.tree != nil {
+		c.tree = newMerkleTree[K](c.tree.depth)
+	}
+	for k, v := range c.m {
+		c.storeDigest(k, v)
+	}
+}
+
+// Digest returns the content digest of key, ok is false if the key doesn't
+// exist, couldn't be encoded or the collection was created without WithDigest
+func (c *Collection[K, _]) Digest(key K) (d Digest, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	d, ok = c.digests[key]
+	return d, ok
+}
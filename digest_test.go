@@ -0,0 +1,93 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCollectionDigest(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork](WithDigest())
+
+	var net ZTNetwork
+	err := json.Unmarshal([]byte(jsonData), &net)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !col.Add(net.NWID, &net) {
+		t.Fatal("new key not reported as changed")
+	}
+	d1, ok := col.Digest(net.NWID)
+	if !ok {
+		t.Fatal("no digest")
+	}
+
+	// equal content behind a different pointer
+	same := net
+	if col.Add(net.NWID, &same) {
+		t.Fatal("equal content reported as changed")
+	}
+
+	// in place modification of the stored pointer
+	same.MTU = 1400
+	if !col.Add(net.NWID, &same) {
+		t.Fatal("modified content not reported as changed")
+	}
+	d2, _ := col.Digest(net.NWID)
+	if d1 == d2 {
+		t.Fatal("digest did not change")
+	}
+
+	want, err := ComputeDigest(same)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2 != want {
+		t.Fatalf("digest of pointer %s != digest of value %s", d2, want)
+	}
+
+	col.Remove(net.NWID)
+	if _, ok := col.Digest(net.NWID); ok {
+		t.Fatal("digest kept after Remove")
+	}
+}
+
+func TestDigestMapOrder(t *testing.T) {
+	a := map[string]int{}
+	b := map[string]int{}
+	for i := range 100 {
+		a[string(rune('a'+i%26))+string(rune('0'+i/26))] = i
+	}
+	for k, v := range a {
+		b[k] = v
+	}
+
+	da, _ := ComputeDigest(a)
+	db, _ := ComputeDigest(b)
+	if da != db {
+		t.Fatal("digest depends on map order")
+	}
+}
+
+func TestCollectionWithoutDigest(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID]()
+	col.Add("a", &ZTPeerID{Address: "a"})
+
+	if _, ok := col.Digest("a"); ok {
+		t.Fatal("digest without WithDigest")
+	}
+}
+
+func BenchmarkCollectionAddDigest(b *testing.B) {
+	var net ZTNetwork
+	err := json.Unmarshal([]byte(jsonData), &net)
+	if err != nil {
+		b.Fatal(err)
+	}
+	col := NewCollection[string, *ZTNetwork](WithDigest())
+
+	for i := range b.N {
+		net.Revision = i % 100
+		col.Add("net", &net)
+	}
+}
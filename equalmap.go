@@ -0,0 +1,168 @@
+package syncmap
+
+import (
+	"iter"
+	"reflect"
+	"strconv"
+)
+
+// ///////////////////////////
+// Equal Collection
+// ///////////////////////////
+
+// Equaler is implemented by values that know how to compare their content
+type Equaler[V any] interface {
+	Equal(V) bool
+}
+
+// EqualCollection is a Collection for values that aren't comparable, or
+// pointers whose content should be compared instead of the address
+type EqualCollection[K MapKey, V any] struct {
+	mtx   *rwMutex
+	m     map[K]V
+	equal func(a, b V) bool
+
+	wait   waiters[K]
+	events events[K, V]
+}
+
+// NewEqualCollection creates new empty m: map[K]V compared with equal.
+// If equal is nil V's Equal method is used if V implements Equaler[V],
+// otherwise reflect.DeepEqual
+func NewEqualCollection[K MapKey, V any](equal func(a, b V) bool) *EqualCollection[K, V] {
+	var c EqualCollection[K, V]
+	return newEqualCollection(&c, equal)
+}
+
+func newEqualCollection[K MapKey, V any](c *EqualCollection[K, V], equal func(a, b V) bool) *EqualCollection[K, V] {
+	c.mtx = newRWMutex()
+	c.m = make(map[K]V)
+	c.equal = equal
+	if c.equal == nil {
+		c.equal = defaultEqual[V]()
+	}
+	return c
+}
+
+func defaultEqual[V any]() func(a, b V) bool {
+	var v V
+	if _, ok := any(v).(Equaler[V]); ok {
+		return func(a, b V) bool {
+			return any(a).(Equaler[V]).Equal(b)
+		}
+	}
+	return func(a, b V) bool {
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// Exists check if key exists
+func (c *EqualCollection[K, _]) Exists(key K) (ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	_, ok = c.m[key]
+	return ok
+}
+
+// Get val with key
+func (c *EqualCollection[K, V]) Get(key K) (val V, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	val, ok = c.m[key]
+	return val, ok
+}
+
+// Get copy of whole map
+func (c *EqualCollection[K, V]) ToMap() map[K]V {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	m := make(map[K]V, len(c.m))
+	for k, v := range c.m {
+		m[k] = v
+	}
+	return m
+}
+
+// Add key / val to map
+func (c *EqualCollection[K, V]) Add(k K, v V) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.store(k, v)
+}
+
+// Add key / val to map, returns true if the key is new or the content changed
+func (c *EqualCollection[K, V]) AddCompare(k K, v V) (updated bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.store(k, v)
+}
+
+// store sets key / val, emits an event if the content changed, c.mtx must be write locked
+func (c *EqualCollection[K, V]) store(k K, v V) (changed bool) {
+	old, ok := c.m[k]
+	c.m[k] = v
+
+	switch {
+	case !ok:
+		c.events.emit(Event[K, V]{Op: OpAdd, Key: k, Value: v})
+	case !c.equal(old, v):
+		c.events.emit(Event[K, V]{Op: OpUpdate, Key: k, Value: v, Old: old})
+	default:
+		return false
+	}
+	c.wait.notify(k)
+	return true
+}
+
+// Remove key from map
+func (c *EqualCollection[K, V]) Remove(key K) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	old, ok := c.m[key]
+	if !ok {
+		return
+	}
+	delete(c.m, key)
+	c.wait.notify(key)
+	c.events.emit(Event[K, V]{Op: OpRemove, Key: key, Old: old})
+}
+
+// Subscribe returns a subscription to change events, buffering up to buf events
+func (c *EqualCollection[K, V]) Subscribe(buf int) *Subscription[K, V] {
+	return c.events.subscribe(buf)
+}
+
+// Len of map
+func (c *EqualCollection[_, _]) Len() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return len(c.m)
+}
+
+func (c *EqualCollection[_, _]) LenStr() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return strconv.Itoa(len(c.m))
+}
+
+// Iter iterates over all elements of K
+func (c *EqualCollection[K, V]) Iter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mtx.RLock()
+		defer c.mtx.RUnlock()
+
+		for k, v := range c.m {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package syncmap
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+type equalPeer struct {
+	Address string
+	Paths   []string
+}
+
+func (p *equalPeer) Equal(o *equalPeer) bool {
+	return p.Address == o.Address && slices.Equal(p.Paths, o.Paths)
+}
+
+func TestEqualCollectionByValue(t *testing.T) {
+	var net ZTNetwork
+	err := json.Unmarshal([]byte(jsonData), &net)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col := NewEqualCollection[string, ZTNetwork](nil)
+	sub := col.Subscribe(10)
+	defer sub.Close()
+
+	if !col.AddCompare(net.NWID, net) {
+		t.Fatal("new key not reported as updated")
+	}
+
+	same := net
+	same.Rules = append(Rules(nil), net.Rules...)
+	if col.AddCompare(net.NWID, same) {
+		t.Fatal("identical content reported as updated")
+	}
+
+	changed := same
+	changed.Rules = Rules{{Type: "ACTION_DROP"}}
+	if !col.AddCompare(net.NWID, changed) {
+		t.Fatal("changed rules not reported")
+	}
+
+	col.Remove(net.NWID)
+
+	var ops []EventOp
+	for range 3 {
+		ops = append(ops, (<-sub.C).Op)
+	}
+	if !slices.Equal(ops, []EventOp{OpAdd, OpUpdate, OpRemove}) {
+		t.Fatalf("got events %v", ops)
+	}
+}
+
+func TestEqualCollectionEqualer(t *testing.T) {
+	col := NewEqualCollection[string, *equalPeer](nil)
+
+	col.Add("a", &equalPeer{Address: "a", Paths: []string{"10.0.0.1"}})
+	if col.AddCompare("a", &equalPeer{Address: "a", Paths: []string{"10.0.0.1"}}) {
+		t.Fatal("equal content behind a new pointer reported as updated")
+	}
+	if !col.AddCompare("a", &equalPeer{Address: "a", Paths: []string{"10.0.0.2"}}) {
+		t.Fatal("changed paths not reported")
+	}
+}
+
+func TestCollectionEvents(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID]()
+	sub := col.Subscribe(1)
+
+	a := &ZTPeerID{Address: "a"}
+	if !col.AddCompare("a", a) {
+		t.Fatal("new key not reported as updated")
+	}
+	if col.AddCompare("a", a) {
+		t.Fatal("same value reported as updated")
+	}
+	if e := <-sub.C; e.Op != OpAdd || e.Key != "a" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	// missing keys are ignored, not marked through a nil pointer
+	col.Delete("missing")
+	col.UnDelete("missing")
+
+	// overflow the buffer
+	col.Add("b", &ZTPeerID{Address: "b"})
+	col.Add("c", &ZTPeerID{Address: "c"})
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Fatal("lagged subscription not closed")
+	}
+	if sub.Err() != ErrLagged {
+		t.Fatalf("got %v, want ErrLagged", sub.Err())
+	}
+	sub.Close()
+}
+
+func TestEqualCollectionWait(t *testing.T) {
+	col := NewEqualCollection[string, *equalPeer](nil)
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		col.Add("a", &equalPeer{Address: "a"})
+		time.Sleep(5 * time.Millisecond)
+		col.Add("b", &equalPeer{Address: "b"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := col.WaitFor(ctx, "a")
+	if err != nil || p.Address != "a" {
+		t.Fatalf("got %v %v", p, err)
+	}
+	err = col.WaitUntil(ctx, func(c ReadOnlyCollection[string, *equalPeer]) bool {
+		return c.Len() == 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package syncmap
+
+import (
+	"errors"
+	"sync"
+)
+
+// ///////////////////////////
+// Change events
+// ///////////////////////////
+
+type EventOp uint8
+
+const (
+	OpAdd      EventOp = iota + 1 // new key
+	OpUpdate                      // value of existing key changed
+	OpRemove                      // key removed
+	OpDelete                      // marked as deleted
+	OpUndelete                    // marked as not deleted
+	OpReset                       // whole map replaced, Key and Value are empty
+)
+
+func (o EventOp) String() string {
+	switch o {
+	case OpAdd:
+		return "add"
+	case OpUpdate:
+		return "update"
+	case OpRemove:
+		return "remove"
+	case OpDelete:
+		return "delete"
+	case OpUndelete:
+		return "undelete"
+	case OpReset:
+		return "reset"
+	}
+	return "unknown"
+}
+
+// Event describes one change. Old is the previous value for OpUpdate and
+// OpRemove. Rev is the collection revision after the change, 0 for
+// collections without revisions
+type Event[K MapKey, V any] struct {
+	Op    EventOp
+	Key   K
+	Value V
+	Old   V
+	Rev   uint64
+}
+
+// ErrLagged is returned by Subscription.Err when the subscriber didn't keep
+// up and events were dropped
+var ErrLagged = errors.New("syncmap: subscriber lagged, events dropped")
+
+// Subscription receives change events on C until closed. C is closed when
+// the subscriber falls more than the buffer size behind, Err then returns ErrLagged
+type Subscription[K MapKey, V any] struct {
+	C <-chan Event[K, V]
+
+	ch  chan Event[K, V]
+	hub *events[K, V]
+	err error
+}
+
+// Close stops delivery and closes C
+func (s *Subscription[K, V]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
+
+// Err returns ErrLagged if events were dropped
+func (s *Subscription[K, V]) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.err
+}
+
+// events fans changes out to subscribers without blocking the writer.
+// The zero value is ready to use.
+type events[K MapKey, V any] struct {
+	mu   sync.Mutex
+	subs map[*Subscription[K, V]]struct{}
+}
+
+func (h *events[K, V]) subscribe(buf int) *Subscription[K, V] {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if buf < 1 {
+		buf = 1
+	}
+	s := &Subscription[K, V]{
+		ch:  make(chan Event[K, V], buf),
+		hub: h,
+	}
+	s.C = s.ch
+
+	if h.subs == nil {
+		h.subs = make(map[*Subscription[K, V]]struct{})
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+func (h *events[K, V]) emit(e Event[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		select {
+		case s.ch <- e:
+		default:
+			s.err = ErrLagged
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
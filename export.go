@@ -0,0 +1,226 @@
+package syncmap
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ///////////////////////////
+// Streaming export
+// ///////////////////////////
+// Exports copy the keys and values under the read lock and encode one
+// value at a time, the lock is never held during I/O.
+
+type exportOptions struct {
+	sorted bool
+}
+
+// ExportOption configures an export
+type ExportOption func(*exportOptions)
+
+// SortedKeys exports in key order, keys are compared by their formatted value
+func SortedKeys() ExportOption {
+	return func(o *exportOptions) {
+		o.sorted = true
+	}
+}
+
+// exportSnapshot returns the values to export in export order
+func (c *Collection[K, V]) exportSnapshot(opts []ExportOption) []V {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	keys, vals := c.snapshotKV()
+	if !o.sorted {
+		return vals
+	}
+
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortFunc(idx, func(a, b int) int {
+		return compareKeys(keys[a], keys[b])
+	})
+
+	sorted := make([]V, len(vals))
+	for i, j := range idx {
+		sorted[i] = vals[j]
+	}
+	return sorted
+}
+
+// ExportJSONL writes one JSON encoded value per line
+func (c *Collection[K, V]) ExportJSONL(w io.Writer, opts ...ExportOption) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for _, v := range c.exportSnapshot(opts) {
+		err := enc.Encode(v)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportCBORSeq writes the values as an RFC 8742 CBOR sequence in canonical encoding
+func (c *Collection[K, V]) ExportCBORSeq(w io.Writer, opts ...ExportOption) error {
+	bw := bufio.NewWriter(w)
+	enc := canonicalEnc.NewEncoder(bw)
+
+	for _, v := range c.exportSnapshot(opts) {
+		err := enc.Encode(v)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportCSV writes a header and one row per value. V must be a struct or a
+// pointer to one. Columns name fields by their csv tag, json tag or field
+// name, nested fields are joined with dots, eg "v6AssignMode.zt". No
+// columns exports all top level exported fields. Slices, maps and nested
+// structs are written as JSON
+func (c *Collection[K, V]) ExportCSV(w io.Writer, columns []string, opts ...ExportOption) error {
+	t := reflect.TypeFor[V]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("syncmap: can't export %s as CSV", t)
+	}
+
+	if len(columns) == 0 {
+		columns = csvColumns(t)
+	}
+	fields := make([][]int, len(columns))
+	for i, col := range columns {
+		idx, err := csvField(t, col)
+		if err != nil {
+			return err
+		}
+		fields[i] = idx
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(columns)
+	if err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, v := range c.exportSnapshot(opts) {
+		rv := reflect.ValueOf(v)
+		for i, idx := range fields {
+			row[i], err = csvValue(rv, idx)
+			if err != nil {
+				return fmt.Errorf("syncmap: column %s: %w", columns[i], err)
+			}
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvName is the column name of a field, "" if it's skipped
+func csvName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	for _, tag := range []string{"csv", "json"} {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func csvColumns(t reflect.Type) (columns []string) {
+	for i := range t.NumField() {
+		if name := csvName(t.Field(i)); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// csvField resolves a dotted column name to a field index path
+func csvField(t reflect.Type, column string) (idx []int, err error) {
+	for _, part := range strings.Split(column, ".") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("syncmap: unknown CSV column %q", column)
+		}
+
+		found := false
+		for i := range t.NumField() {
+			if csvName(t.Field(i)) == part {
+				idx = append(idx, i)
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("syncmap: unknown CSV column %q", column)
+		}
+	}
+	return idx, nil
+}
+
+func csvValue(v reflect.Value, idx []int) (string, error) {
+	for _, i := range idx {
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return "", nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return x.String(), nil
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		b, err := json.Marshal(v.Interface())
+		return string(b), err
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
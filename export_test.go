@@ -0,0 +1,114 @@
+package syncmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func exportNetworks(n int) *Collection[string, *ZTNetwork] {
+	col := NewCollection[string, *ZTNetwork]()
+	for i := range n {
+		id := fmt.Sprintf("net-%03d", i)
+		col.Add(id, &ZTNetwork{
+			NWID:         id,
+			Name:         "network " + id,
+			MTU:          2800,
+			V6AssignMode: V6AssignMode{ZT: i%2 == 0},
+			Routes:       []ZTRoutes{{Target: "10.0.0.0/24"}},
+		})
+	}
+	return col
+}
+
+func TestExportJSONLRoundTrip(t *testing.T) {
+	col := exportNetworks(100)
+
+	var buf bytes.Buffer
+	err := col.ExportJSONL(&buf, SortedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := bufio.NewScanner(&buf)
+	i := 0
+	for s.Scan() {
+		var n ZTNetwork
+		err = json.Unmarshal(s.Bytes(), &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("net-%03d", i); n.NWID != want {
+			t.Fatalf("line %d: %s, want %s", i, n.NWID, want)
+		}
+		i++
+	}
+	if i != 100 {
+		t.Fatalf("%d lines, want 100", i)
+	}
+}
+
+func TestExportCBORSeqRoundTrip(t *testing.T) {
+	col := exportNetworks(100)
+
+	var a, b bytes.Buffer
+	if err := col.ExportCBORSeq(&a, SortedKeys()); err != nil {
+		t.Fatal(err)
+	}
+	if err := col.ExportCBORSeq(&b, SortedKeys()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatal("sorted export is not deterministic")
+	}
+
+	imported := NewCollection[string, *ZTNetwork]()
+	res, err := imported.ImportCBORSeq(&a, networkID)
+	if err != nil || res.Err() != nil {
+		t.Fatal(err, res.Err())
+	}
+	if !Diff[string, *ZTNetwork](col, imported).Empty() {
+		t.Fatal("round trip changed values")
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	col := exportNetworks(3)
+
+	var buf bytes.Buffer
+	err := col.ExportCSV(&buf, []string{"nwid", "mtu", "v6AssignMode.zt", "routes"}, SortedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != "nwid,mtu,v6AssignMode.zt,routes" {
+		t.Fatalf("unexpected header %v", rows)
+	}
+	want := []string{"net-000", "2800", "true", `[{"target":"10.0.0.0/24"}]`}
+	if strings.Join(rows[1], "|") != strings.Join(want, "|") {
+		t.Fatalf("got %v, want %v", rows[1], want)
+	}
+
+	err = col.ExportCSV(&buf, []string{"nope"})
+	if err == nil {
+		t.Fatal("unknown column accepted")
+	}
+
+	buf.Reset()
+	err = col.ExportCSV(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _ := csv.NewReader(&buf).Read()
+	if len(header) != 19 || header[0] != "id" {
+		t.Fatalf("default columns %v", header)
+	}
+}
@@ -0,0 +1,448 @@
+// Package gossip spreads the contents of a syncmap.Collection between
+// nodes by periodic push-pull gossip over a Transport.
+//
+// Every entry carries a hybrid logical clock stamp of its last change, the
+// newest stamp wins. Each round a node sends a digest of its stamps to a
+// few random peers, which reply with theirs. Both sides then pull the
+// entries where the other is newer. Digests carry a sample of the
+// sender's peers, so nodes started with a single seed learn the rest.
+// Removed keys are kept as tombstones for TombstoneTTL so the removal
+// outruns older copies. Entries already in the collection when the node
+// starts get the lowest stamp, so any copy a peer stamped wins over them.
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkpowell/syncmap"
+)
+
+// Options configures a Node
+type Options struct {
+	// Node is the unique clock ID, random if empty. Transport addresses
+	// like 0.0.0.0:7946 repeat across hosts and make poor IDs
+	Node string
+	// Seeds are the peers known at start, more are learned from the
+	// packets received
+	Seeds []string
+	// Fanout is the number of peers gossiped with per round, 3 if 0
+	Fanout int
+	// Interval between rounds in Run, 1s if 0
+	Interval time.Duration
+	// TombstoneTTL is how long removed keys are remembered, 10m if 0
+	TombstoneTTL time.Duration
+	// MaxBatch caps the digests or entries per packet, 64 if 0
+	MaxBatch int
+	// MaxPacket caps the encoded size of a packet, larger batches are
+	// split. The largest UDP payload if 0
+	MaxPacket int
+	// Seed makes peer selection reproducible, random if 0
+	Seed uint64
+	// OnError is called with send and decoding errors
+	OnError func(error)
+}
+
+// ErrPacketTooLarge is reported when a single digest or entry doesn't fit
+// MaxPacket
+var ErrPacketTooLarge = errors.New("gossip: packet too large")
+
+type msgType uint8
+
+const (
+	msgDigest      msgType = iota + 1 // Digests of the sender, reply with ours
+	msgDigestReply                    // Digests of the sender
+	msgPull                           // send the entries of Keys
+	msgEntries                        // Entries
+)
+
+type stamp[K syncmap.MapKey] struct {
+	Key   K           `cbor:"k"`
+	Stamp syncmap.HLC `cbor:"s"`
+}
+
+type entry[K syncmap.MapKey, V any] struct {
+	Key       K           `cbor:"k"`
+	Stamp     syncmap.HLC `cbor:"s"`
+	Value     V           `cbor:"v,omitempty"`
+	Tombstone bool        `cbor:"t,omitempty"`
+}
+
+type message[K syncmap.MapKey, V any] struct {
+	Type    msgType       `cbor:"1,keyasint"`
+	Digests []stamp[K]    `cbor:"2,keyasint,omitempty"`
+	Keys    []K           `cbor:"3,keyasint,omitempty"`
+	Entries []entry[K, V] `cbor:"4,keyasint,omitempty"`
+	Peers   []string      `cbor:"5,keyasint,omitempty"` // sample of the sender's peers
+}
+
+// meta is the gossip state of one key
+type meta struct {
+	stamp     syncmap.HLC
+	digest    syncmap.Digest
+	tombstone bool
+	died      time.Time // when the tombstone was seen
+}
+
+// Node gossips one collection with its peers
+type Node[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c     *syncmap.Collection[K, V]
+	t     Transport
+	opts  Options
+	clock *syncmap.Clock
+
+	mtx   sync.Mutex
+	meta  map[K]*meta
+	peers map[string]struct{}
+	rng   *rand.Rand
+}
+
+// NewNode creates a node gossiping c over t, call Run or drive it with
+// Round and Receive
+func NewNode[K syncmap.MapKey, V syncmap.MapValue](c *syncmap.Collection[K, V], t Transport, opts Options) *Node[K, V] {
+	if opts.Node == "" {
+		opts.Node = strconv.FormatUint(rand.Uint64(), 16)
+	}
+	if opts.Fanout <= 0 {
+		opts.Fanout = 3
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.TombstoneTTL <= 0 {
+		opts.TombstoneTTL = 10 * time.Minute
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 64
+	}
+	if opts.MaxPacket <= 0 {
+		opts.MaxPacket = maxDatagram
+	}
+	if opts.Seed == 0 {
+		opts.Seed = rand.Uint64()
+	}
+
+	n := &Node[K, V]{
+		c:     c,
+		t:     t,
+		opts:  opts,
+		clock: syncmap.NewClock(opts.Node),
+		meta:  make(map[K]*meta),
+		peers: make(map[string]struct{}),
+		rng:   rand.New(rand.NewPCG(opts.Seed, 0)),
+	}
+	for _, p := range opts.Seeds {
+		n.AddPeer(p)
+	}
+
+	// what's there before we gossip may be a stale copy, eg loaded from
+	// disk, the lowest stamp lets every peer's version win
+	for k, v := range c.IterSnapshot() {
+		n.meta[k] = &meta{stamp: syncmap.HLC{Node: opts.Node}, digest: n.digest(k, v)}
+	}
+	return n
+}
+
+// AddPeer adds a peer to gossip with
+func (n *Node[_, _]) AddPeer(addr string) {
+	if addr == n.t.Addr() {
+		return
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.peers[addr] = struct{}{}
+}
+
+// Peers returns the known peers, sorted
+func (n *Node[_, _]) Peers() []string {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	peers := make([]string, 0, len(n.peers))
+	for p := range n.peers {
+		peers = append(peers, p)
+	}
+	slices.Sort(peers)
+	return peers
+}
+
+// Run gossips every Interval and handles the received packets until ctx
+// is done or the transport is closed
+func (n *Node[K, V]) Run(ctx context.Context) error {
+	tick := time.NewTicker(n.opts.Interval)
+	defer tick.Stop()
+
+	n.Round()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+			n.Round()
+		case p, ok := <-n.t.Recv():
+			if !ok {
+				return ErrClosed
+			}
+			n.Receive(p)
+		}
+	}
+}
+
+// Round picks up local changes, expires tombstones and sends our digest
+// to Fanout random peers
+func (n *Node[K, V]) Round() {
+	n.mtx.Lock()
+	n.scan()
+	n.expire()
+
+	peers := make([]string, 0, len(n.peers))
+	for p := range n.peers {
+		peers = append(peers, p)
+	}
+	slices.Sort(peers)
+	n.rng.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	targets := peers[:min(len(peers), n.opts.Fanout)]
+	digests := n.digests()
+	n.mtx.Unlock()
+
+	for _, p := range targets {
+		n.sendDigests(p, msgDigest, digests, peers)
+	}
+}
+
+// Receive handles one packet
+func (n *Node[K, V]) Receive(p Packet) {
+	var msg message[K, V]
+	err := cbor.Unmarshal(p.Data, &msg)
+	if err != nil {
+		n.fail(err)
+		return
+	}
+	n.AddPeer(p.From)
+	for _, addr := range msg.Peers {
+		n.AddPeer(addr)
+	}
+
+	switch msg.Type {
+	case msgDigest, msgDigestReply:
+		n.mtx.Lock()
+		var pull []K
+		for _, d := range msg.Digests {
+			m := n.current(d.Key)
+			if m == nil || d.Stamp.Compare(m.stamp) > 0 {
+				pull = append(pull, d.Key)
+			}
+		}
+		var digests []stamp[K]
+		var peers []string
+		if msg.Type == msgDigest {
+			digests = n.digests()
+			peers = n.samplePeers()
+		}
+		n.mtx.Unlock()
+
+		if len(pull) > 0 {
+			n.send(p.From, &message[K, V]{Type: msgPull, Keys: pull})
+		}
+		if msg.Type == msgDigest {
+			n.sendDigests(p.From, msgDigestReply, digests, peers)
+		}
+
+	case msgPull:
+		n.mtx.Lock()
+		var entries []entry[K, V]
+		for _, k := range msg.Keys {
+			m := n.current(k)
+			if m == nil {
+				continue
+			}
+			e := entry[K, V]{Key: k, Stamp: m.stamp, Tombstone: m.tombstone}
+			if !m.tombstone {
+				e.Value, _ = n.c.Get(k)
+			}
+			entries = append(entries, e)
+		}
+		n.mtx.Unlock()
+
+		for b := range slices.Chunk(entries, n.opts.MaxBatch) {
+			n.send(p.From, &message[K, V]{Type: msgEntries, Entries: b})
+		}
+
+	case msgEntries:
+		n.mtx.Lock()
+		for _, e := range msg.Entries {
+			n.apply(e)
+		}
+		n.mtx.Unlock()
+	}
+}
+
+// scan stamps the local changes since the last scan, n.mtx must be locked
+func (n *Node[K, V]) scan() {
+	seen := make(map[K]struct{}, n.c.Len())
+	for k, v := range n.c.IterSnapshot() {
+		seen[k] = struct{}{}
+		n.track(k, v)
+	}
+	for k, m := range n.meta {
+		if _, ok := seen[k]; !ok && !m.tombstone {
+			n.bury(k, m)
+		}
+	}
+}
+
+// current returns the meta of key, stamping a local change not yet
+// scanned. n.mtx must be locked
+func (n *Node[K, V]) current(k K) *meta {
+	v, ok := n.c.Get(k)
+	m := n.meta[k]
+	switch {
+	case ok:
+		n.track(k, v)
+	case m != nil && !m.tombstone:
+		n.bury(k, m)
+	}
+	return n.meta[k]
+}
+
+// digest of the value v stored at k
+func (n *Node[K, V]) digest(k K, v V) syncmap.Digest {
+	d, ok := n.c.Digest(k)
+	if !ok {
+		d, _ = syncmap.ComputeDigest(v)
+	}
+	return d
+}
+
+// track stamps v if it changed, n.mtx must be locked
+func (n *Node[K, V]) track(k K, v V) {
+	d := n.digest(k, v)
+	m := n.meta[k]
+	if m != nil && !m.tombstone && m.digest == d {
+		return
+	}
+	n.meta[k] = &meta{stamp: n.clock.Now(), digest: d}
+}
+
+// bury turns a locally removed key into a tombstone, n.mtx must be locked
+func (n *Node[K, V]) bury(k K, m *meta) {
+	*m = meta{stamp: n.clock.Now(), tombstone: true, died: time.Now()}
+}
+
+// expire forgets old tombstones, n.mtx must be locked
+func (n *Node[K, V]) expire() {
+	for k, m := range n.meta {
+		if m.tombstone && time.Since(m.died) > n.opts.TombstoneTTL {
+			delete(n.meta, k)
+		}
+	}
+}
+
+// digests lists the stamps of all keys, n.mtx must be locked
+func (n *Node[K, V]) digests() []stamp[K] {
+	d := make([]stamp[K], 0, len(n.meta))
+	for k, m := range n.meta {
+		d = append(d, stamp[K]{Key: k, Stamp: m.stamp})
+	}
+	return d
+}
+
+// apply stores a received entry if it's newer, n.mtx must be locked
+func (n *Node[K, V]) apply(e entry[K, V]) {
+	m := n.current(e.Key)
+	if m != nil && e.Stamp.Compare(m.stamp) <= 0 {
+		return
+	}
+	n.clock.Observe(e.Stamp)
+
+	if e.Tombstone {
+		n.c.Remove(e.Key)
+		n.meta[e.Key] = &meta{stamp: e.Stamp, tombstone: true, died: time.Now()}
+		return
+	}
+
+	n.c.Add(e.Key, e.Value)
+	n.meta[e.Key] = &meta{stamp: e.Stamp, digest: n.digest(e.Key, e.Value)}
+}
+
+// samplePeers picks up to MaxBatch known peers, n.mtx must be locked
+func (n *Node[K, V]) samplePeers() []string {
+	peers := make([]string, 0, min(len(n.peers), n.opts.MaxBatch))
+	for p := range n.peers {
+		if len(peers) == cap(peers) {
+			break
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// sendDigests sends digests in batches, peers go with the first
+func (n *Node[K, V]) sendDigests(to string, typ msgType, digests []stamp[K], peers []string) {
+	peers = peers[:min(len(peers), n.opts.MaxBatch)]
+	if len(digests) == 0 {
+		n.send(to, &message[K, V]{Type: typ, Peers: peers})
+		return
+	}
+	for b := range slices.Chunk(digests, n.opts.MaxBatch) {
+		n.send(to, &message[K, V]{Type: typ, Digests: b, Peers: peers})
+		peers = nil
+	}
+}
+
+// send encodes msg, halving its batch until the packets fit MaxPacket
+func (n *Node[K, V]) send(to string, msg *message[K, V]) {
+	b, err := cbor.Marshal(msg)
+	if err == nil && len(b) > n.opts.MaxPacket {
+		if first, second, ok := msg.split(); ok {
+			n.send(to, first)
+			n.send(to, second)
+			return
+		}
+		err = fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, len(b))
+	}
+	if err == nil {
+		err = n.t.Send(to, b)
+	}
+	if err != nil {
+		n.fail(err)
+	}
+}
+
+// split halves the digests, keys or entries of msg, the peers go with the
+// first half. ok is false if there's nothing left to split
+func (msg *message[K, V]) split() (a, b *message[K, V], ok bool) {
+	a = &message[K, V]{Type: msg.Type, Peers: msg.Peers}
+	b = &message[K, V]{Type: msg.Type}
+	switch {
+	case len(msg.Digests) > 1:
+		h := len(msg.Digests) / 2
+		a.Digests, b.Digests = msg.Digests[:h], msg.Digests[h:]
+	case len(msg.Keys) > 1:
+		h := len(msg.Keys) / 2
+		a.Keys, b.Keys = msg.Keys[:h], msg.Keys[h:]
+	case len(msg.Entries) > 1:
+		h := len(msg.Entries) / 2
+		a.Entries, b.Entries = msg.Entries[:h], msg.Entries[h:]
+	default:
+		return nil, nil, false
+	}
+	return a, b, true
+}
+
+func (n *Node[_, _]) fail(err error) {
+	if n.opts.OnError != nil {
+		n.opts.OnError(err)
+	}
+}
@@ -0,0 +1,258 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+type peer struct {
+	ID       string `cbor:"id"`
+	Address  string `cbor:"address"`
+	Hostname string `cbor:"hostname"`
+	Deleted  bool   `cbor:"deleted"`
+}
+
+func (p *peer) GetID() string { return p.ID }
+func (p *peer) Del(b bool)    { p.Deleted = b }
+
+type sim struct {
+	t         *testing.T
+	net       *MemNetwork
+	ts        []*MemTransport
+	nodes     []*Node[string, *peer]
+	cols      []*syncmap.Collection[string, *peer]
+	maxPacket int // checked on delivery if > 0
+}
+
+// newSim connects n nodes in a ring, they learn the others by gossip
+func newSim(t *testing.T, n int, opts Options) *sim {
+	s := &sim{t: t, net: NewMemNetwork()}
+	for i := range n {
+		tr := s.net.Listen(fmt.Sprintf("node-%02d", i), 4096)
+		col := syncmap.NewCollection[string, *peer](syncmap.WithDigest())
+
+		o := opts
+		o.Seeds = []string{fmt.Sprintf("node-%02d", (i+1)%n)}
+		o.Seed = uint64(i + 1)
+		s.ts = append(s.ts, tr)
+		s.cols = append(s.cols, col)
+		s.nodes = append(s.nodes, NewNode(col, tr, o))
+	}
+	return s
+}
+
+// round runs one gossip round on every node and delivers all packets
+func (s *sim) round() {
+	for _, n := range s.nodes {
+		n.Round()
+	}
+	for delivered := true; delivered; {
+		delivered = false
+		for i, tr := range s.ts {
+			for len(tr.Recv()) > 0 {
+				p := <-tr.Recv()
+				if s.maxPacket > 0 && len(p.Data) > s.maxPacket {
+					s.t.Fatalf("%d byte packet", len(p.Data))
+				}
+				s.nodes[i].Receive(p)
+				delivered = true
+			}
+		}
+	}
+}
+
+func (s *sim) converged() bool {
+	for _, c := range s.cols[1:] {
+		if !syncmap.Diff[string, *peer](s.cols[0], c).Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// settle runs rounds until the collections converge, returns the rounds needed
+func (s *sim) settle(max int) int {
+	s.t.Helper()
+
+	for r := 1; r <= max; r++ {
+		s.round()
+		if s.converged() {
+			return r
+		}
+	}
+	s.t.Fatalf("not converged after %d rounds", max)
+	return 0
+}
+
+func addPeers(c *syncmap.Collection[string, *peer], prefix string, n int) {
+	for i := range n {
+		id := fmt.Sprintf("%s%02d", prefix, i)
+		c.Add(id, &peer{ID: id, Address: "10.147.17." + fmt.Sprint(i), Hostname: id})
+	}
+}
+
+func TestGossipMemNetwork(t *testing.T) {
+	s := newSim(t, 40, Options{})
+	addPeers(s.cols[0], "a", 20)
+	addPeers(s.cols[17], "b", 5)
+
+	rounds := s.settle(40)
+	t.Logf("converged in %d rounds", rounds)
+	if s.cols[39].Len() != 25 {
+		t.Fatalf("node 39 has %d peers, want 25", s.cols[39].Len())
+	}
+	if len(s.nodes[5].Peers()) < 3 {
+		t.Fatalf("node 5 only knows %v", s.nodes[5].Peers())
+	}
+
+	// a removal spreads as a tombstone, an update wins over older copies
+	s.cols[3].Remove("a01")
+	s.cols[30].Add("b02", &peer{ID: "b02", Address: "10.147.17.99"})
+	s.settle(40)
+
+	for i, c := range s.cols {
+		if c.Exists("a01") {
+			t.Fatalf("node %d still has a01", i)
+		}
+		if p, _ := c.Get("b02"); p.Address != "10.147.17.99" {
+			t.Fatalf("node %d has old b02 %+v", i, p)
+		}
+	}
+
+	// concurrent edits of one key settle on one of them
+	s.cols[1].Add("a02", &peer{ID: "a02", Hostname: "one"})
+	s.cols[2].Add("a02", &peer{ID: "a02", Hostname: "two"})
+	s.settle(40)
+}
+
+func TestGossipTombstoneTTL(t *testing.T) {
+	s := newSim(t, 2, Options{TombstoneTTL: time.Millisecond})
+	addPeers(s.cols[0], "a", 2)
+	s.settle(5)
+
+	s.cols[0].Remove("a00")
+	s.settle(5)
+	if s.cols[1].Exists("a00") {
+		t.Fatal("removal not spread")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	s.round()
+	for i, n := range s.nodes {
+		if _, ok := n.meta["a00"]; ok {
+			t.Fatalf("node %d kept the tombstone", i)
+		}
+	}
+}
+
+func TestGossipNodeID(t *testing.T) {
+	net := NewMemNetwork()
+	a := NewNode(syncmap.NewCollection[string, *peer](), net.Listen("0.0.0.0:7946", 1), Options{})
+	b := NewNode(syncmap.NewCollection[string, *peer](), net.Listen("0.0.0.0:7946", 1), Options{})
+	if a.opts.Node == "" || a.opts.Node == "0.0.0.0:7946" || a.opts.Node == b.opts.Node {
+		t.Fatalf("node ids %q and %q", a.opts.Node, b.opts.Node)
+	}
+}
+
+func TestGossipStaleAtStart(t *testing.T) {
+	s := &sim{t: t, net: NewMemNetwork()}
+	start := func(name string, col *syncmap.Collection[string, *peer], seeds ...string) {
+		tr := s.net.Listen(name, 4096)
+		s.ts = append(s.ts, tr)
+		s.cols = append(s.cols, col)
+		s.nodes = append(s.nodes, NewNode(col, tr, Options{Seeds: seeds, Seed: 1}))
+	}
+
+	start("node-00", syncmap.NewCollection[string, *peer]())
+	s.cols[0].Add("a", &peer{ID: "a", Hostname: "new"})
+	s.round()
+
+	// a node restarting later with an old copy loses to the live one
+	time.Sleep(time.Millisecond)
+	stale := syncmap.NewCollection[string, *peer]()
+	stale.Add("a", &peer{ID: "a", Hostname: "old"})
+	stale.Add("b", &peer{ID: "b", Hostname: "only here"})
+	start("node-01", stale, "node-00")
+
+	s.settle(10)
+	for i, c := range s.cols {
+		if p, _ := c.Get("a"); p.Hostname != "new" {
+			t.Fatalf("node %d has %+v", i, p)
+		}
+		if !c.Exists("b") {
+			t.Fatalf("node %d misses b", i)
+		}
+	}
+}
+
+func TestGossipMaxPacket(t *testing.T) {
+	s := newSim(t, 3, Options{MaxPacket: 2000})
+	s.maxPacket = 2000
+	for i := range 40 {
+		id := fmt.Sprint("big", i)
+		s.cols[0].Add(id, &peer{ID: id, Hostname: strings.Repeat("x", 500)})
+	}
+	s.settle(20)
+
+	var errs []error
+	n := NewNode(s.cols[0], s.net.Listen("small", 1), Options{MaxPacket: 100, OnError: func(err error) {
+		errs = append(errs, err)
+	}})
+	n.send("node-01", &message[string, *peer]{Type: msgEntries, Entries: []entry[string, *peer]{{Key: "big0", Value: &peer{Hostname: strings.Repeat("x", 500)}}}})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrPacketTooLarge) {
+		t.Fatalf("got %v, want ErrPacketTooLarge", errs)
+	}
+}
+
+func TestGossipUDP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cols []*syncmap.Collection[string, *peer]
+	var addrs []string
+	var done []chan error
+	for i := range 3 {
+		tr, err := ListenUDP("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tr.Close()
+
+		col := syncmap.NewCollection[string, *peer]()
+		var seeds []string
+		if i > 0 {
+			seeds = []string{addrs[i-1]}
+		}
+		n := NewNode(col, tr, Options{Seeds: seeds, Interval: 5 * time.Millisecond})
+
+		ch := make(chan error, 1)
+		go func() { ch <- n.Run(ctx) }()
+		cols = append(cols, col)
+		addrs = append(addrs, tr.Addr())
+		done = append(done, ch)
+	}
+
+	addPeers(cols[0], "a", 10)
+	addPeers(cols[2], "c", 10)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cols[0].Len() != 20 || cols[1].Len() != 20 || cols[2].Len() != 20 {
+		if time.Now().After(deadline) {
+			t.Fatalf("not converged: %d %d %d", cols[0].Len(), cols[1].Len(), cols[2].Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	for _, ch := range done {
+		if err := <-ch; err != context.Canceled {
+			t.Fatalf("Run returned %v", err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package gossip
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Packet is one datagram
+type Packet struct {
+	From string
+	Data []byte
+}
+
+// Transport sends and receives datagrams, delivery is best effort
+type Transport interface {
+	// Addr is the address peers send to
+	Addr() string
+	// Send delivers data to the peer at addr
+	Send(addr string, data []byte) error
+	// Recv delivers the received packets until Close
+	Recv() <-chan Packet
+	Close() error
+}
+
+// ErrClosed is returned when sending on a closed transport
+var ErrClosed = errors.New("gossip: transport closed")
+
+// ///////////////////////////
+// UDP transport
+// ///////////////////////////
+
+// maxDatagram is the largest UDP payload
+const maxDatagram = 65507
+
+// UDPTransport is a Transport over a UDP socket
+type UDPTransport struct {
+	conn *net.UDPConn
+	recv chan Packet
+}
+
+// ListenUDP opens a UDP transport on addr, eg "0.0.0.0:7946"
+func ListenUDP(addr string) (*UDPTransport, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", ua)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &UDPTransport{conn: conn, recv: make(chan Packet, 256)}
+	go t.read()
+	return t, nil
+}
+
+func (t *UDPTransport) read() {
+	defer close(t.recv)
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		p := Packet{From: from.String(), Data: append([]byte(nil), buf[:n]...)}
+		select {
+		case t.recv <- p:
+		default:
+			// full, drop like the network would
+		}
+	}
+}
+
+func (t *UDPTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *UDPTransport) Send(addr string, data []byte) error {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteToUDP(data, ua)
+	return err
+}
+
+func (t *UDPTransport) Recv() <-chan Packet {
+	return t.recv
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
+
+// ///////////////////////////
+// In-memory transport
+// ///////////////////////////
+
+// MemNetwork connects in-memory transports by address, for tests and
+// simulations. Packets to unknown or full endpoints are dropped
+type MemNetwork struct {
+	mtx       sync.Mutex
+	endpoints map[string]*MemTransport
+}
+
+// NewMemNetwork creates an empty network
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{endpoints: make(map[string]*MemTransport)}
+}
+
+// Listen attaches a transport with addr, buffering up to buf packets
+func (n *MemNetwork) Listen(addr string, buf int) *MemTransport {
+	t := &MemTransport{net: n, addr: addr, recv: make(chan Packet, buf)}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.endpoints[addr] = t
+	return t
+}
+
+// MemTransport is a Transport on a MemNetwork
+type MemTransport struct {
+	net    *MemNetwork
+	addr   string
+	recv   chan Packet
+	closed bool // guarded by net.mtx
+}
+
+func (t *MemTransport) Addr() string {
+	return t.addr
+}
+
+func (t *MemTransport) Send(addr string, data []byte) error {
+	t.net.mtx.Lock()
+	defer t.net.mtx.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+	to, ok := t.net.endpoints[addr]
+	if !ok {
+		return nil
+	}
+	select {
+	case to.recv <- Packet{From: t.addr, Data: append([]byte(nil), data...)}:
+	default:
+	}
+	return nil
+}
+
+func (t *MemTransport) Recv() <-chan Packet {
+	return t.recv
+}
+
+func (t *MemTransport) Close() error {
+	t.net.mtx.Lock()
+	defer t.net.mtx.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	delete(t.net.endpoints, t.addr)
+	close(t.recv)
+	return nil
+}
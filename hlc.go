@@ -0,0 +1,85 @@
+package syncmap
+
+import (
+	"cmp"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ///////////////////////////
+// Hybrid logical clock
+// ///////////////////////////
+
+// HLC is a hybrid logical clock timestamp. Wall follows physical time,
+// Logical orders events within the same Wall and Node breaks ties
+type HLC struct {
+	Wall    int64  `json:"wall" cbor:"w"` // unix nanoseconds
+	Logical uint32 `json:"logical" cbor:"l"`
+	Node    string `json:"node" cbor:"n"`
+}
+
+// Compare orders a and b by Wall, Logical, then Node
+func (a HLC) Compare(b HLC) int {
+	if c := cmp.Compare(a.Wall, b.Wall); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Logical, b.Logical); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Node, b.Node)
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%s.%d@%s", time.Unix(0, h.Wall).UTC().Format(time.RFC3339Nano), h.Logical, h.Node)
+}
+
+// Clock issues HLC timestamps for one node
+type Clock struct {
+	mtx  sync.Mutex
+	node string
+	last HLC
+	now  func() int64
+}
+
+// NewClock creates a clock for node, node must be unique among the replicas
+func NewClock(node string) *Clock {
+	return &Clock{
+		node: node,
+		last: HLC{Node: node},
+		now: func() int64 {
+			return time.Now().UnixNano()
+		},
+	}
+}
+
+// Now returns a timestamp for a local event, greater than all before
+func (c *Clock) Now() HLC {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if pt := c.now(); pt > c.last.Wall {
+		c.last.Wall, c.last.Logical = pt, 0
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Observe advances the clock past a received timestamp
+func (c *Clock) Observe(h HLC) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	pt := c.now()
+	switch {
+	case pt > c.last.Wall && pt > h.Wall:
+		c.last.Wall, c.last.Logical = pt, 0
+	case h.Wall > c.last.Wall:
+		c.last.Wall, c.last.Logical = h.Wall, h.Logical+1
+	case h.Wall == c.last.Wall:
+		c.last.Logical = max(c.last.Logical, h.Logical) + 1
+	default:
+		c.last.Logical++
+	}
+}
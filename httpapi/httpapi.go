@@ -0,0 +1,393 @@
+// Package httpapi serves a syncmap.Collection over HTTP.
+//
+//	GET    /                  paginated list, ?limit=N&after=<cursor>
+//	GET    /{key}             one entry, ETag is the entry revision
+//	PUT    /{key}             add or replace, honours If-Match / If-None-Match
+//	DELETE /{key}             mark as deleted, ?hard=1 removes the entry
+//	POST   /{key}/undelete    mark as not deleted
+//
+// Bodies are JSON or CBOR, chosen by Content-Type and Accept. Events
+// streams the changes as Server-Sent Events, Mirror keeps a local copy
+// from such a stream.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkpowell/syncmap"
+)
+
+const (
+	MimeJSON = "application/json"
+	MimeCBOR = "application/cbor"
+)
+
+// Options configures Handler
+type Options[K syncmap.MapKey] struct {
+	// ParseKey converts a path segment to a key, required unless K is a string
+	ParseKey func(string) (K, error)
+	// PageSize is the default list page size, 100 if 0
+	PageSize int
+	// MaxPageSize caps ?limit, 1000 if 0
+	MaxPageSize int
+	// MaxBodyBytes caps PUT bodies, 1 MiB if 0
+	MaxBodyBytes int64
+}
+
+// Item is one entry of a list page
+type Item[K syncmap.MapKey, V any] struct {
+	Key   K      `json:"key" cbor:"key"`
+	Rev   uint64 `json:"rev" cbor:"rev"`
+	Value V      `json:"value" cbor:"value"`
+}
+
+// Page is the response of GET /, pass Next as ?after= to get the next page
+type Page[K syncmap.MapKey, V any] struct {
+	Items []Item[K, V] `json:"items" cbor:"items"`
+	Next  string       `json:"next,omitempty" cbor:"next,omitempty"`
+}
+
+type handler[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c    *syncmap.Collection[K, V]
+	opts Options[K]
+}
+
+// Handler returns an http.Handler for c, mount it with http.StripPrefix
+func Handler[K syncmap.MapKey, V syncmap.MapValue](c *syncmap.Collection[K, V], opts Options[K]) http.Handler {
+	if opts.ParseKey == nil {
+		opts.ParseKey = func(s string) (k K, err error) {
+			p, ok := any(&k).(*string)
+			if !ok {
+				return k, fmt.Errorf("httpapi: no ParseKey for %T", k)
+			}
+			*p = s
+			return k, nil
+		}
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+	if opts.MaxPageSize <= 0 {
+		opts.MaxPageSize = 1000
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+
+	h := &handler[K, V]{c: c, opts: opts}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.list)
+	mux.HandleFunc("GET /{key}", h.get)
+	mux.HandleFunc("PUT /{key}", h.put)
+	mux.HandleFunc("DELETE /{key}", h.delete)
+	mux.HandleFunc("POST /{key}/undelete", h.undelete)
+	return mux
+}
+
+// ETag formats a revision as a strong entity tag
+func ETag(rev uint64) string {
+	return `"` + strconv.FormatUint(rev, 10) + `"`
+}
+
+func (h *handler[K, V]) list(w http.ResponseWriter, r *http.Request) {
+	limit := h.opts.PageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, h.opts.MaxPageSize)
+	}
+	after := r.URL.Query().Get("after")
+
+	type entry struct {
+		key  K
+		name string
+	}
+	var keys []entry
+	for k := range h.c.Iter() {
+		name := fmt.Sprint(k)
+		if after == "" || name > after {
+			keys = append(keys, entry{k, name})
+		}
+	}
+	slices.SortFunc(keys, func(a, b entry) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	page := Page[K, V]{Items: make([]Item[K, V], 0, min(limit, len(keys)))}
+	for i, e := range keys {
+		if len(page.Items) == limit {
+			page.Next = keys[i-1].name
+			break
+		}
+		v, rev, ok := h.c.GetRev(e.key)
+		if !ok {
+			continue // removed since listing
+		}
+		page.Items = append(page.Items, Item[K, V]{Key: e.key, Rev: rev, Value: v})
+	}
+
+	writeBody(w, r, http.StatusOK, page)
+}
+
+func (h *handler[K, V]) key(w http.ResponseWriter, r *http.Request) (k K, ok bool) {
+	k, err := h.opts.ParseKey(r.PathValue("key"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return k, false
+	}
+	return k, true
+}
+
+func (h *handler[K, V]) get(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	v, rev, ok := h.c.GetRev(k)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", ETag(rev))
+	if etagMatch(r.Header.Get("If-None-Match"), rev, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeBody(w, r, http.StatusOK, v)
+}
+
+func (h *handler[K, V]) put(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	var v V
+	status, err := readBody(r, w, h.opts.MaxBodyBytes, &v)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if isNil(v) {
+		http.Error(w, syncmap.ErrNilValue.Error(), http.StatusBadRequest)
+		return
+	}
+	if val, ok := any(v).(syncmap.Validator); ok {
+		err = val.Validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	cond := precondition(r)
+	var existed bool
+	rev, err := h.c.AddCond(k, v, func(rev uint64, ok bool) error {
+		existed = ok
+		if cond == nil {
+			return nil
+		}
+		return cond(rev, ok)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", ETag(rev))
+	if !existed {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) delete(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	if hard, _ := strconv.ParseBool(r.URL.Query().Get("hard")); hard {
+		err := h.c.RemoveCond(k, precondition(r))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	rev, err := h.c.DeleteCond(k, precondition(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", ETag(rev))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) undelete(w http.ResponseWriter, r *http.Request) {
+	k, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+
+	rev, err := h.c.UnDeleteCond(k, precondition(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", ETag(rev))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// precondition turns If-Match / If-None-Match into a syncmap.Precondition
+func precondition(r *http.Request) syncmap.Precondition {
+	match := r.Header.Get("If-Match")
+	noneMatch := r.Header.Get("If-None-Match")
+	if match == "" && noneMatch == "" {
+		return nil
+	}
+
+	return func(rev uint64, ok bool) error {
+		if match != "" && (!ok || !etagMatch(match, rev, false)) {
+			return syncmap.ErrRevMismatch
+		}
+		if noneMatch != "" && ok && etagMatch(noneMatch, rev, true) {
+			return syncmap.ErrRevMismatch
+		}
+		return nil
+	}
+}
+
+// etagMatch reports if header lists rev or is "*". Weak tags only match
+// with weak comparison, as used by If-None-Match
+func etagMatch(header string, rev uint64, weak bool) bool {
+	if header == "" {
+		return false
+	}
+	tag := ETag(rev)
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, syncmap.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, syncmap.ErrRevMismatch):
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// wantsCBOR reports if the client accepts CBOR before JSON
+func wantsCBOR(r *http.Request) bool {
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := mime.ParseMediaType(strings.TrimSpace(a))
+		switch mt {
+		case MimeCBOR:
+			return true
+		case MimeJSON, "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+func writeBody(w http.ResponseWriter, r *http.Request, status int, v any) {
+	var (
+		b   []byte
+		err error
+		ct  = MimeJSON
+	)
+	if wantsCBOR(r) {
+		ct = MimeCBOR
+		b, err = cbor.Marshal(v)
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func readBody(r *http.Request, w http.ResponseWriter, limit int64, v any) (status int, err error) {
+	ct := MimeJSON
+	if s := r.Header.Get("Content-Type"); s != "" {
+		ct, _, err = mime.ParseMediaType(s)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusBadRequest, err
+	}
+
+	switch ct {
+	case MimeJSON:
+		err = json.Unmarshal(b, v)
+	case MimeCBOR:
+		err = cbor.Unmarshal(b, v)
+	default:
+		return http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %s", ct)
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// isNil reports if a decoded body is nil, eg null for a pointer V
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkpowell/syncmap"
+)
+
+type device struct {
+	ID       string `json:"id" cbor:"id"`
+	Hostname string `json:"hostname" cbor:"hostname"`
+	Deleted  bool   `json:"deleted" cbor:"deleted"`
+}
+
+func (d *device) GetID() string { return d.ID }
+func (d *device) Del(b bool)    { d.Deleted = b }
+
+func (d *device) Validate() error {
+	if d.Hostname == "" {
+		return fmt.Errorf("hostname required")
+	}
+	return nil
+}
+
+func newServer(t *testing.T) (*httptest.Server, *syncmap.Collection[string, *device]) {
+	t.Helper()
+
+	c := syncmap.NewCollection[string, *device]()
+	srv := httptest.NewServer(Handler(c, Options[string]{PageSize: 2}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func do(t *testing.T, method, url string, body []byte, header ...string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+
+	if resp.StatusCode != want {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status %d, want %d: %s", resp.Request.Method, resp.Request.URL, resp.StatusCode, want, b)
+	}
+}
+
+func TestPutGetConditional(t *testing.T) {
+	srv, c := newServer(t)
+
+	resp := do(t, "PUT", srv.URL+"/a", []byte(`{"id":"a","hostname":"host-a"}`), "If-None-Match", "*")
+	expectStatus(t, resp, http.StatusCreated)
+	etag := resp.Header.Get("ETag")
+
+	// create only fails once it exists
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`{"id":"a","hostname":"host-a"}`), "If-None-Match", "*")
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+
+	resp = do(t, "GET", srv.URL+"/a", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var d device
+	json.NewDecoder(resp.Body).Decode(&d)
+	if d.Hostname != "host-a" || resp.Header.Get("ETag") != etag {
+		t.Fatalf("got %+v etag %s", d, resp.Header.Get("ETag"))
+	}
+
+	resp = do(t, "GET", srv.URL+"/a", nil, "If-None-Match", etag)
+	expectStatus(t, resp, http.StatusNotModified)
+
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`{"id":"a","hostname":"host-b"}`), "If-Match", etag)
+	expectStatus(t, resp, http.StatusNoContent)
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("ETag not changed by update")
+	}
+
+	// lost update
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`{"id":"a","hostname":"host-c"}`), "If-Match", etag)
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+	if v, _ := c.Get("a"); v.Hostname != "host-b" {
+		t.Fatalf("hostname %s after failed precondition", v.Hostname)
+	}
+
+	resp = do(t, "GET", srv.URL+"/missing", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestPutInvalid(t *testing.T) {
+	srv, _ := newServer(t)
+
+	resp := do(t, "PUT", srv.URL+"/a", []byte(`{"id":"a"}`))
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`{`))
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`null`))
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = do(t, "PUT", srv.URL+"/a", []byte(`<x/>`), "Content-Type", "text/xml")
+	expectStatus(t, resp, http.StatusUnsupportedMediaType)
+}
+
+func TestCBORNegotiation(t *testing.T) {
+	srv, _ := newServer(t)
+
+	body, _ := cbor.Marshal(&device{ID: "a", Hostname: "host-a"})
+	resp := do(t, "PUT", srv.URL+"/a", body, "Content-Type", MimeCBOR)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = do(t, "GET", srv.URL+"/a", nil, "Accept", MimeCBOR)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Type") != MimeCBOR {
+		t.Fatalf("content type %s", resp.Header.Get("Content-Type"))
+	}
+	var d device
+	err := cbor.NewDecoder(resp.Body).Decode(&d)
+	if err != nil || d.Hostname != "host-a" {
+		t.Fatalf("got %+v, %v", d, err)
+	}
+}
+
+func TestDeleteUndelete(t *testing.T) {
+	srv, c := newServer(t)
+	c.Add("a", &device{ID: "a", Hostname: "host-a"})
+
+	resp := do(t, "DELETE", srv.URL+"/a", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	if v, _ := c.Get("a"); !v.Deleted {
+		t.Fatal("not soft deleted")
+	}
+
+	resp = do(t, "POST", srv.URL+"/a/undelete", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	if v, _ := c.Get("a"); v.Deleted {
+		t.Fatal("not undeleted")
+	}
+
+	resp = do(t, "DELETE", srv.URL+"/a?hard=1", nil, "If-Match", `"1"`)
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+
+	resp = do(t, "DELETE", srv.URL+"/a?hard=1", nil)
+	expectStatus(t, resp, http.StatusNoContent)
+	if c.Exists("a") {
+		t.Fatal("not removed")
+	}
+
+	resp = do(t, "DELETE", srv.URL+"/a", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+	resp = do(t, "POST", srv.URL+"/a/undelete", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestListPages(t *testing.T) {
+	srv, c := newServer(t)
+	for _, k := range []string{"e", "b", "d", "a", "c"} {
+		c.Add(k, &device{ID: k, Hostname: "host-" + k})
+	}
+
+	var keys []string
+	url := srv.URL + "/"
+	for range 10 {
+		resp := do(t, "GET", url, nil)
+		expectStatus(t, resp, http.StatusOK)
+
+		var page Page[string, *device]
+		err := json.NewDecoder(resp.Body).Decode(&page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) > 2 {
+			t.Fatalf("page of %d items", len(page.Items))
+		}
+		for _, it := range page.Items {
+			if it.Rev == 0 || it.Value.ID != it.Key {
+				t.Fatalf("bad item %+v", it)
+			}
+			keys = append(keys, it.Key)
+		}
+		if page.Next == "" {
+			break
+		}
+		url = srv.URL + "/?after=" + page.Next
+	}
+
+	if fmt.Sprint(keys) != "[a b c d e]" {
+		t.Fatalf("listed %v", keys)
+	}
+
+	resp := do(t, "GET", srv.URL+"/?limit=x", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
@@ -0,0 +1,387 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// MirrorOptions configures a Mirror
+type MirrorOptions struct {
+	// Client makes the requests, http.DefaultClient if nil. It must not
+	// have a timeout shorter than the stream
+	Client *http.Client
+	// MinBackoff is the first reconnect delay, 100ms if 0
+	MinBackoff time.Duration
+	// MaxBackoff caps the reconnect delay, 30s if 0
+	MaxBackoff time.Duration
+	// OnError is called with connection and decoding errors
+	OnError func(error)
+}
+
+// MirrorStats describes how current a Mirror is
+type MirrorStats struct {
+	Synced      bool      // a snapshot was loaded
+	Connected   bool      // the stream is open
+	Rev         uint64    // revision of the source last applied
+	Epoch       uint64    // epoch of the source Rev belongs to, see syncmap.Collection.Epoch
+	LastSync    time.Time // last snapshot
+	LastContact time.Time // last event or heartbeat
+	Reconnects  uint64
+	LastError   error
+}
+
+// Staleness is the time since the source was last heard from, 0 before
+// the first contact
+func (s MirrorStats) Staleness() time.Duration {
+	if s.LastContact.IsZero() {
+		return 0
+	}
+	return time.Since(s.LastContact)
+}
+
+// Mirror is a read only local copy of a Collection served by Events on
+// another process. It loads the snapshot, applies the changes and
+// reconnects with backoff, resuming from its revision unless the source
+// epoch changed
+type Mirror[K syncmap.MapKey, V any] struct {
+	url  string
+	opts MirrorOptions
+
+	mtx    sync.RWMutex
+	m      map[K]V
+	stats  MirrorStats
+	synced chan struct{} // closed by the first snapshot
+}
+
+// NewMirror creates an empty mirror of the Events stream at url, call Run
+// to start it
+func NewMirror[K syncmap.MapKey, V any](url string, opts MirrorOptions) *Mirror[K, V] {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	return &Mirror[K, V]{
+		url:    url,
+		opts:   opts,
+		m:      make(map[K]V),
+		synced: make(chan struct{}),
+	}
+}
+
+// Run keeps the mirror up to date until ctx is done. The contents are
+// kept when the connection drops
+func (m *Mirror[K, V]) Run(ctx context.Context) error {
+	backoff := m.opts.MinBackoff
+	for {
+		heard, err := m.stream(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		m.fail(err)
+		if heard {
+			backoff = m.opts.MinBackoff
+		}
+
+		// full jitter over the upper half
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, m.opts.MaxBackoff)
+
+		m.mtx.Lock()
+		m.stats.Reconnects++
+		m.mtx.Unlock()
+	}
+}
+
+// HasSynced reports if the first snapshot was loaded
+func (m *Mirror[_, _]) HasSynced() bool {
+	select {
+	case <-m.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitSynced blocks until the first snapshot is loaded or ctx is done
+func (m *Mirror[_, _]) WaitSynced(ctx context.Context) error {
+	select {
+	case <-m.synced:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the sync state
+func (m *Mirror[_, _]) Stats() MirrorStats {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.stats
+}
+
+// Rev is the revision of the source last applied
+func (m *Mirror[_, _]) Rev() uint64 {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.stats.Rev
+}
+
+// ErrEpochChanged is returned by a stream whose events switched to another
+// epoch of the source, the mirror reconnects for a new snapshot
+var ErrEpochChanged = errors.New("httpapi: mirror source epoch changed")
+
+// Exists check if key exists
+func (m *Mirror[K, _]) Exists(key K) (ok bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	_, ok = m.m[key]
+	return ok
+}
+
+// Get val with key
+func (m *Mirror[K, V]) Get(key K) (val V, ok bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	val, ok = m.m[key]
+	return val, ok
+}
+
+// Get val with key and write to v
+func (m *Mirror[K, V]) GetP(key K, val *V) (ok bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	*val, ok = m.m[key]
+	return ok
+}
+
+// ToMap returns a copy of the map, the mirror replaces its contents
+// while running
+func (m *Mirror[K, V]) ToMap() map[K]V {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return maps.Clone(m.m)
+}
+
+// Len of map
+func (m *Mirror[_, _]) Len() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return len(m.m)
+}
+
+func (m *Mirror[_, _]) LenStr() string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return strconv.Itoa(len(m.m))
+}
+
+// Iter iterates over all elements of K
+func (m *Mirror[K, V]) Iter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+
+		for k, v := range m.m {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// All iterates over all elements of K, same as Iter
+func (m *Mirror[K, V]) All() iter.Seq2[K, V] {
+	return m.Iter()
+}
+
+// IterSnapshot iterates over a copy of all elements of K. The lock is only
+// held while copying, so the loop body doesn't hold up the stream
+func (m *Mirror[K, V]) IterSnapshot() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for k, v := range m.ToMap() {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Mirror[_, _]) fail(err error) {
+	m.mtx.Lock()
+	m.stats.Connected = false
+	m.stats.LastError = err
+	m.mtx.Unlock()
+
+	if m.opts.OnError != nil {
+		m.opts.OnError(err)
+	}
+}
+
+// stream reads one connection until it fails, heard is true if any event
+// arrived
+func (m *Mirror[K, V]) stream(ctx context.Context) (heard bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if id := m.lastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+
+	resp, err := m.opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("httpapi: mirror %s: %s", m.url, resp.Status)
+	}
+
+	m.mtx.Lock()
+	m.stats.Connected = true
+	m.mtx.Unlock()
+
+	r := bufio.NewReader(resp.Body)
+	var name, id string
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return heard, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m.contact()
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			if name == "" && data == nil {
+				continue
+			}
+			err = m.apply(name, id, strings.Join(data, "\n"))
+			if err != nil {
+				return heard, err
+			}
+			heard = true
+			name, id, data = "", "", nil
+		case field == "":
+			// comment, eg heartbeat
+		case field == "event":
+			name = value
+		case field == "id":
+			id = value
+		case field == "data":
+			data = append(data, value)
+		}
+	}
+}
+
+// lastEventID is the id to resume from, empty before a snapshot of a
+// known epoch was loaded
+func (m *Mirror[_, _]) lastEventID() string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if !m.stats.Synced || m.stats.Epoch == 0 {
+		return ""
+	}
+	return eventID(m.stats.Epoch, m.stats.Rev)
+}
+
+func (m *Mirror[_, _]) contact() {
+	m.mtx.Lock()
+	m.stats.LastContact = time.Now()
+	m.mtx.Unlock()
+}
+
+func (m *Mirror[K, V]) apply(name, id, data string) error {
+	epoch, _, _ := parseEventID(id)
+	switch name {
+	case "snapshot":
+		var snap Snapshot[K, V]
+		err := json.Unmarshal([]byte(data), &snap)
+		if err != nil {
+			return err
+		}
+		fresh := make(map[K]V, len(snap.Items))
+		for _, it := range snap.Items {
+			fresh[it.Key] = it.Value
+		}
+
+		m.mtx.Lock()
+		m.m = fresh
+		m.stats.Rev = snap.Rev
+		m.stats.Epoch = epoch
+		m.stats.Synced = true
+		m.stats.LastSync = time.Now()
+		m.mtx.Unlock()
+
+		if !m.HasSynced() {
+			close(m.synced)
+		}
+	case "change":
+		var ch Change[K, V]
+		err := json.Unmarshal([]byte(data), &ch)
+		if err != nil {
+			return err
+		}
+
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+
+		if epoch != m.stats.Epoch {
+			// the revisions can't be compared, reconnect for a snapshot
+			m.stats.Epoch = 0
+			return ErrEpochChanged
+		}
+		if ch.Rev <= m.stats.Rev {
+			// already in the snapshot
+			return nil
+		}
+		if ch.Op == syncmap.OpRemove.String() {
+			delete(m.m, ch.Key)
+		} else {
+			m.m[ch.Key] = ch.Value
+		}
+		m.stats.Rev = ch.Rev
+	}
+	return nil
+}
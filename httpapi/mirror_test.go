@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// eventually polls cond until it holds or a second passed
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func startMirror(t *testing.T, url string) *Mirror[string, *device] {
+	t.Helper()
+
+	m := NewMirror[string, *device](url, MirrorOptions{MinBackoff: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	wait, cancelWait := context.WithTimeout(ctx, time.Second)
+	defer cancelWait()
+	if err := m.WaitSynced(wait); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMirror(t *testing.T) {
+	c := syncmap.NewCollection[string, *device](syncmap.WithChangeLog(100))
+	c.Add("a", &device{ID: "a", Hostname: "host-a"})
+	c.Add("b", &device{ID: "b", Hostname: "host-b"})
+
+	srv := httptest.NewServer(Events(c, EventOptions{Heartbeat: 10 * time.Millisecond}))
+	t.Cleanup(srv.Close)
+
+	m := startMirror(t, srv.URL)
+	if !m.HasSynced() || m.Len() != 2 || m.Rev() != 2 {
+		t.Fatalf("synced %v len %d rev %d", m.HasSynced(), m.Len(), m.Rev())
+	}
+	if v, ok := m.Get("a"); !ok || v.Hostname != "host-a" {
+		t.Fatalf("got %+v", v)
+	}
+
+	c.Add("c", &device{ID: "c", Hostname: "host-c"})
+	c.Remove("a")
+	c.Delete("b")
+	eventually(t, "changes not applied", func() bool { return m.Rev() == 5 })
+
+	if m.Exists("a") || !m.Exists("c") {
+		t.Fatal("add / remove not mirrored")
+	}
+	if v, _ := m.Get("b"); !v.Deleted {
+		t.Fatal("delete not mirrored")
+	}
+	var v *device
+	if !m.GetP("c", &v) || v.Hostname != "host-c" {
+		t.Fatalf("GetP got %+v", v)
+	}
+	cp := m.ToMap()
+	delete(cp, "c")
+	if !m.Exists("c") {
+		t.Fatal("ToMap returned the live map")
+	}
+	n := 0
+	for k := range m.IterSnapshot() {
+		m.Get(k)
+		n++
+	}
+	for range m.All() {
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("iterated %d entries, want 4", n)
+	}
+
+	// heartbeats keep the mirror fresh
+	time.Sleep(30 * time.Millisecond)
+	if st := m.Stats(); !st.Connected || st.Staleness() > 25*time.Millisecond {
+		t.Fatalf("stale while connected %+v", st)
+	}
+}
+
+func TestMirrorReconnect(t *testing.T) {
+	for _, changeLog := range []int{0, 100} {
+		var opts []syncmap.Option
+		if changeLog > 0 {
+			opts = append(opts, syncmap.WithChangeLog(changeLog))
+		}
+		c := syncmap.NewCollection[string, *device](opts...)
+		c.Add("a", &device{ID: "a", Hostname: "host-a"})
+
+		srv := httptest.NewServer(Events(c, EventOptions{Heartbeat: 10 * time.Millisecond}))
+		t.Cleanup(srv.Close)
+
+		m := startMirror(t, srv.URL)
+		lastSync := m.Stats().LastSync
+
+		srv.CloseClientConnections()
+		c.Add("b", &device{ID: "b", Hostname: "host-b"})
+		c.Remove("a")
+
+		eventually(t, "changes after reconnect not applied", func() bool { return m.Rev() == 3 })
+		if m.Exists("a") || !m.Exists("b") {
+			t.Fatal("mirror out of sync after reconnect")
+		}
+
+		st := m.Stats()
+		if st.Reconnects == 0 || st.LastError == nil {
+			t.Fatalf("reconnect not counted %+v", st)
+		}
+		// with a change log the mirror resumes without a new snapshot
+		if resumed := st.LastSync.Equal(lastSync); resumed != (changeLog > 0) {
+			t.Fatalf("change log %d, resumed %v", changeLog, resumed)
+		}
+	}
+}
+
+func TestMirrorEpoch(t *testing.T) {
+	c := syncmap.NewCollection[string, *device](syncmap.WithChangeLog(100))
+	c.Add("a", &device{ID: "a", Hostname: "host-a"})
+
+	var h atomic.Pointer[http.Handler]
+	serve := func(c *syncmap.Collection[string, *device]) {
+		events := Events(c, EventOptions{Heartbeat: 10 * time.Millisecond})
+		h.Store(&events)
+	}
+	serve(c)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*h.Load()).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	m := startMirror(t, srv.URL)
+	if st := m.Stats(); st.Epoch != c.Epoch() {
+		t.Fatalf("epoch %x, want %x", st.Epoch, c.Epoch())
+	}
+
+	// a restarted source with other contents past the mirror revision
+	c = syncmap.NewCollection[string, *device](syncmap.WithChangeLog(100))
+	c.Add("x", &device{ID: "x"})
+	c.Add("y", &device{ID: "y"})
+	serve(c)
+	srv.CloseClientConnections()
+
+	eventually(t, "no snapshot after restart", func() bool { return m.Stats().Epoch == c.Epoch() })
+	if m.Exists("a") || !m.Exists("x") || m.Rev() != 2 {
+		t.Fatalf("mirror out of sync after restart %v", m.ToMap())
+	}
+
+	// a change of another epoch forces a new snapshot
+	if err := m.apply("change", eventID(c.Epoch()+1, 3), `{"op":"add","key":"z","rev":3}`); err != ErrEpochChanged {
+		t.Fatalf("got %v, want ErrEpochChanged", err)
+	}
+	c.Add("z", &device{ID: "z"})
+	eventually(t, "no snapshot after epoch change", func() bool { return m.Stats().Epoch == c.Epoch() && m.Exists("z") })
+}
+
+func TestMirrorUnreachable(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	srv.Close()
+
+	errs := make(chan error, 10)
+	m := NewMirror[string, *device](srv.URL, MirrorOptions{
+		MinBackoff: time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v", err)
+	}
+	if m.HasSynced() || len(errs) == 0 || m.Stats().Reconnects == 0 {
+		t.Fatalf("synced %v errors %d stats %+v", m.HasSynced(), len(errs), m.Stats())
+	}
+}
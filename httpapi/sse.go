@@ -0,0 +1,215 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// EventOptions configures Events
+type EventOptions struct {
+	// Heartbeat is the interval of keep-alive comments, 15s if 0
+	Heartbeat time.Duration
+	// Buffer is the number of events a client may lag behind, 256 if 0
+	Buffer int
+	// ResnapshotOnLag sends a fresh snapshot to a lagging client instead
+	// of dropping the connection
+	ResnapshotOnLag bool
+}
+
+// Snapshot is the data of a "snapshot" event, it replaces the client state
+type Snapshot[K syncmap.MapKey, V any] struct {
+	Rev   uint64       `json:"rev"`
+	Items []Item[K, V] `json:"items"`
+}
+
+// Change is the data of a "change" event
+type Change[K syncmap.MapKey, V any] struct {
+	Op    string `json:"op"`
+	Key   K      `json:"key"`
+	Value V      `json:"value,omitempty"`
+	Rev   uint64 `json:"rev"`
+}
+
+// Events returns an http.Handler streaming changes of c as Server-Sent
+// Events. A client first gets a "snapshot" event, then a "change" event per
+// change, each with the epoch and revision as id, see eventID. A client
+// reconnecting with Last-Event-ID resumes from the change log if c has one
+// and the epoch is unchanged, see syncmap.WithChangeLog, otherwise it gets
+// a new snapshot
+func Events[K syncmap.MapKey, V syncmap.MapValue](c *syncmap.Collection[K, V], opts EventOptions) http.Handler {
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = 15 * time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 256
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		s := &sseStream[K, V]{c: c, w: w, buf: opts.Buffer}
+		defer s.close()
+
+		if epoch, rev, ok := parseEventID(r.Header.Get("Last-Event-ID")); ok {
+			s.resume(epoch, rev)
+		}
+		if s.sub == nil {
+			s.snapshot()
+		}
+		if s.err != nil {
+			return
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(opts.Heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				s.write(": heartbeat\n\n")
+			case e, ok := <-s.sub.C:
+				if !ok {
+					// lagged past the buffer
+					if !opts.ResnapshotOnLag {
+						return
+					}
+					s.snapshot()
+					break
+				}
+				s.change(e)
+				// send what's queued before flushing
+				for len(s.sub.C) > 0 && s.err == nil {
+					if e, ok := <-s.sub.C; ok {
+						s.change(e)
+					}
+				}
+			}
+			if s.err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+// eventID formats the id of an event, the hex epoch and the decimal
+// revision. Revisions of another epoch are of another history, eg before a
+// restart, and can't be resumed from
+func eventID(epoch, rev uint64) string {
+	return strconv.FormatUint(epoch, 16) + "-" + strconv.FormatUint(rev, 10)
+}
+
+// parseEventID is the inverse of eventID
+func parseEventID(id string) (epoch, rev uint64, ok bool) {
+	e, r, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	epoch, err := strconv.ParseUint(e, 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	rev, err = strconv.ParseUint(r, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return epoch, rev, true
+}
+
+type sseStream[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c     *syncmap.Collection[K, V]
+	w     http.ResponseWriter
+	buf   int
+	sub   *syncmap.Subscription[K, V]
+	epoch uint64 // of the events sent
+	err   error
+}
+
+func (s *sseStream[K, V]) close() {
+	if s.sub != nil {
+		s.sub.Close()
+	}
+}
+
+func (s *sseStream[K, V]) write(str string) {
+	if s.err == nil {
+		_, s.err = io.WriteString(s.w, str)
+	}
+}
+
+func (s *sseStream[K, V]) event(name string, rev uint64, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.write(fmt.Sprintf("event: %s\nid: %s\ndata: %s\n\n", name, eventID(s.epoch, rev), b))
+}
+
+// snapshot sends the whole collection and subscribes to the changes after it
+func (s *sseStream[K, V]) snapshot() {
+	s.close()
+
+	entries, rev, epoch, sub := s.c.SubscribeEntries(s.buf)
+	s.epoch = epoch
+	s.sub = sub
+
+	snap := Snapshot[K, V]{Rev: rev, Items: make([]Item[K, V], 0, len(entries))}
+	for _, e := range entries {
+		snap.Items = append(snap.Items, Item[K, V]{Key: e.Key, Rev: e.Rev, Value: e.Value})
+	}
+	s.event("snapshot", rev, snap)
+}
+
+// resume replays the logged changes after rev in epoch, leaves s.sub nil
+// if it can't
+func (s *sseStream[K, V]) resume(epoch, rev uint64) {
+	if epoch != s.c.Epoch() {
+		return
+	}
+	missed, sub, ok := s.c.SubscribeSince(rev, s.buf)
+	if !ok {
+		return
+	}
+	if epoch != s.c.Epoch() {
+		// restored in between, the log is of another history
+		sub.Close()
+		return
+	}
+	s.epoch = epoch
+	s.sub = sub
+	for _, e := range missed {
+		s.change(e)
+		if e.Op == syncmap.OpReset {
+			// the snapshot includes the rest
+			return
+		}
+	}
+}
+
+func (s *sseStream[K, V]) change(e syncmap.Event[K, V]) {
+	if e.Op == syncmap.OpReset {
+		// whole map replaced
+		s.snapshot()
+		return
+	}
+	s.event("change", e.Rev, Change[K, V]{Op: e.Op.String(), Key: e.Key, Value: e.Value, Rev: e.Rev})
+}
@@ -0,0 +1,209 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+type sseEvent struct {
+	name string
+	id   string
+	data string
+}
+
+// readEvents parses events from an SSE stream, skipping comments
+func readEvents(t *testing.T, r *bufio.Reader, n int) (events []sseEvent) {
+	t.Helper()
+
+	var e sseEvent
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("after %d events: %v", len(events), err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.name != "" {
+				events = append(events, e)
+			}
+			e = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func connect(t *testing.T, url, lastID string) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type %s", resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventsSnapshotAndChanges(t *testing.T) {
+	c := syncmap.NewCollection[string, *device](syncmap.WithChangeLog(100))
+	c.Add("a", &device{ID: "a", Hostname: "host-a"})
+
+	srv := httptest.NewServer(Events(c, EventOptions{Heartbeat: 10 * time.Millisecond}))
+	t.Cleanup(srv.Close) // after the streams are cancelled
+
+	r := connect(t, srv.URL, "")
+	ev := readEvents(t, r, 1)
+	var snap Snapshot[string, *device]
+	json.Unmarshal([]byte(ev[0].data), &snap)
+	if ev[0].name != "snapshot" || len(snap.Items) != 1 || snap.Items[0].Value.Hostname != "host-a" || snap.Items[0].Rev != 1 {
+		t.Fatalf("unexpected snapshot %+v", ev[0])
+	}
+
+	c.Add("b", &device{ID: "b", Hostname: "host-b"})
+	c.Remove("a")
+
+	ev = readEvents(t, r, 2)
+	var add, rm Change[string, *device]
+	json.Unmarshal([]byte(ev[0].data), &add)
+	json.Unmarshal([]byte(ev[1].data), &rm)
+	if add.Op != "add" || add.Key != "b" || add.Value.Hostname != "host-b" || ev[0].id != eventID(c.Epoch(), 2) {
+		t.Fatalf("unexpected add %+v", ev[0])
+	}
+	if rm.Op != "remove" || rm.Key != "a" || rm.Value != nil || ev[1].id != eventID(c.Epoch(), 3) {
+		t.Fatalf("unexpected remove %+v", ev[1])
+	}
+
+	// resume from the change log
+	r = connect(t, srv.URL, eventID(c.Epoch(), 1))
+	ev = readEvents(t, r, 2)
+	if ev[0].name != "change" || ev[0].id != eventID(c.Epoch(), 2) || ev[1].id != eventID(c.Epoch(), 3) {
+		t.Fatalf("unexpected resume %+v", ev)
+	}
+
+	// resume beyond the current revision, from another epoch or from an
+	// id without epoch falls back to a snapshot
+	for _, id := range []string{eventID(c.Epoch(), 99), eventID(c.Epoch()+1, 1), "1"} {
+		r = connect(t, srv.URL, id)
+		ev = readEvents(t, r, 1)
+		if ev[0].name != "snapshot" || ev[0].id != eventID(c.Epoch(), 3) {
+			t.Fatalf("unexpected resume from %s %+v", id, ev)
+		}
+	}
+}
+
+func TestEventsResumeWithoutLog(t *testing.T) {
+	c := syncmap.NewCollection[string, *device]()
+	c.Add("a", &device{ID: "a", Hostname: "host-a"})
+
+	srv := httptest.NewServer(Events(c, EventOptions{}))
+	t.Cleanup(srv.Close) // after the streams are cancelled
+
+	ev := readEvents(t, connect(t, srv.URL, eventID(c.Epoch(), 0)), 1)
+	if ev[0].name != "snapshot" {
+		t.Fatalf("got %s, want snapshot", ev[0].name)
+	}
+}
+
+// gatedWriter blocks writes while gate is locked
+type gatedWriter struct {
+	gate   sync.Mutex
+	mu     sync.Mutex
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (w *gatedWriter) Header() http.Header { return w.header }
+func (w *gatedWriter) WriteHeader(int)     {}
+func (w *gatedWriter) Flush()              {}
+
+func (w *gatedWriter) Write(b []byte) (int, error) {
+	w.gate.Lock()
+	w.gate.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *gatedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestEventsLag(t *testing.T) {
+	for _, resnapshot := range []bool{false, true} {
+		c := syncmap.NewCollection[string, *device]()
+		h := Events(c, EventOptions{Buffer: 2, ResnapshotOnLag: resnapshot})
+
+		w := &gatedWriter{header: http.Header{}}
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+		done := make(chan struct{})
+		go func() {
+			h.ServeHTTP(w, req)
+			close(done)
+		}()
+		for !strings.Contains(w.String(), "event: snapshot") {
+			time.Sleep(time.Millisecond)
+		}
+
+		// slow consumer
+		w.gate.Lock()
+		for i := range 10 {
+			k := string(rune('a' + i))
+			c.Add(k, &device{ID: k, Hostname: k})
+		}
+		w.gate.Unlock()
+
+		if !resnapshot {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("lagging client not dropped")
+			}
+			cancel()
+			continue
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for strings.Count(w.String(), "event: snapshot") < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("no fresh snapshot after lag:\n%s", w.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if !strings.Contains(w.String(), `"key":"j"`) {
+			t.Fatal("fresh snapshot misses the latest change")
+		}
+		cancel()
+		<-done
+	}
+}
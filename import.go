@@ -0,0 +1,178 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ///////////////////////////
+// Streaming import
+// ///////////////////////////
+
+// importBatch is the number of records stored per lock acquisition
+const importBatch = 256
+
+// ErrNilValue is reported for records that decode to a nil V, eg null
+var ErrNilValue = errors.New("syncmap: nil value")
+
+// RecordError is a record that couldn't be decoded or validated
+type RecordError struct {
+	Index int // position in the stream
+	Err   error
+}
+
+func (e RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Index, e.Err)
+}
+
+func (e RecordError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Records int // records read from the stream
+	Changed int // records that added or changed a key
+	Errors  []RecordError
+}
+
+// Err joins the record errors, nil if all records were imported
+func (r ImportResult) Err() error {
+	errs := make([]error, len(r.Errors))
+	for i, e := range r.Errors {
+		errs[i] = e
+	}
+	return errors.Join(errs...)
+}
+
+// ImportJSON reads a JSON array of V and adds each element under keyFn(v).
+// Elements are decoded one at a time and stored in batches. Elements that
+// don't decode into V or fail Validate are reported in the result, a
+// malformed stream stops the import with an error
+func (c *Collection[K, V]) ImportJSON(r io.Reader, keyFn func(V) K) (res ImportResult, err error) {
+	d := json.NewDecoder(r)
+
+	tok, err := d.Token()
+	if err != nil {
+		return res, err
+	}
+	if tok != json.Delim('[') {
+		return res, fmt.Errorf("syncmap: expected JSON array, got %v", tok)
+	}
+
+	b := c.newImporter(keyFn, &res)
+	for d.More() {
+		var raw json.RawMessage
+		err = d.Decode(&raw)
+		if err != nil {
+			b.flush()
+			return res, err
+		}
+
+		var v V
+		b.add(v, json.Unmarshal(raw, &v))
+	}
+	b.flush()
+
+	_, err = d.Token()
+	return res, err
+}
+
+// ImportCBORSeq reads an RFC 8742 CBOR sequence of V and adds each item
+// under keyFn(v), like ImportJSON
+func (c *Collection[K, V]) ImportCBORSeq(r io.Reader, keyFn func(V) K) (res ImportResult, err error) {
+	d := cbor.NewDecoder(r)
+
+	b := c.newImporter(keyFn, &res)
+	defer b.flush()
+
+	for {
+		var raw cbor.RawMessage
+		err = d.Decode(&raw)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+
+		var v V
+		b.add(v, cbor.Unmarshal(raw, &v))
+	}
+}
+
+type importer[K MapKey, V MapValue] struct {
+	c     *Collection[K, V]
+	keyFn func(V) K
+	res   *ImportResult
+	batch []V
+}
+
+func (c *Collection[K, V]) newImporter(keyFn func(V) K, res *ImportResult) *importer[K, V] {
+	return &importer[K, V]{
+		c:     c,
+		keyFn: keyFn,
+		res:   res,
+		batch: make([]V, 0, importBatch),
+	}
+}
+
+// add queues a decoded record or records its error
+func (b *importer[K, V]) add(v V, err error) {
+	i := b.res.Records
+	b.res.Records++
+
+	if err == nil && isNil(v) {
+		err = ErrNilValue
+	}
+	if err == nil {
+		if val, ok := any(v).(Validator); ok {
+			err = val.Validate()
+		}
+	}
+	if err != nil {
+		b.res.Errors = append(b.res.Errors, RecordError{Index: i, Err: err})
+		return
+	}
+
+	b.batch = append(b.batch, v)
+	if len(b.batch) == importBatch {
+		b.flush()
+	}
+}
+
+// flush stores the queued records under one write lock
+func (b *importer[K, V]) flush() {
+	if len(b.batch) == 0 {
+		return
+	}
+
+	b.c.mtx.Lock()
+	for _, v := range b.batch {
+		if b.c.store(b.keyFn(v), v) {
+			b.res.Changed++
+		}
+	}
+	b.c.mtx.Unlock()
+
+	clear(b.batch)
+	b.batch = b.batch[:0]
+}
+
+// isNil reports if v is a nil pointer, map, slice, func, chan or interface
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package syncmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func networkID(n *ZTNetwork) string { return n.NWID }
+
+func TestImportJSON(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := range 1000 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		switch i {
+		case 10:
+			b.WriteString(`{"nwid":"bad","mtu":"not a number"}`)
+		case 500:
+			b.WriteString(`"not an object"`)
+		default:
+			fmt.Fprintf(&b, `{"nwid":"net-%d","mtu":2800}`, i)
+		}
+	}
+	b.WriteString("]")
+
+	col := NewCollection[string, *ZTNetwork]()
+	col.Add("net-1", &ZTNetwork{NWID: "net-1", MTU: 2800})
+
+	res, err := col.ImportJSON(strings.NewReader(b.String()), networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Records != 1000 || len(res.Errors) != 2 || col.Len() != 998 {
+		t.Fatalf("records %d, errors %v, len %d", res.Records, res.Errors, col.Len())
+	}
+	if res.Errors[0].Index != 10 || res.Errors[1].Index != 500 {
+		t.Fatalf("unexpected error indexes %v", res.Errors)
+	}
+	if res.Err() == nil {
+		t.Fatal("Err() nil with record errors")
+	}
+	// net-1 was replaced by a different pointer
+	if res.Changed != 998 {
+		t.Fatalf("changed %d, want 998", res.Changed)
+	}
+}
+
+func TestImportJSONMalformed(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+
+	_, err := col.ImportJSON(strings.NewReader(`{"nwid":"a"}`), networkID)
+	if err == nil {
+		t.Fatal("accepted object instead of array")
+	}
+
+	res, err := col.ImportJSON(strings.NewReader(`[{"nwid":"a"},{"nwid":`), networkID)
+	if err == nil {
+		t.Fatal("accepted truncated stream")
+	}
+	if res.Records != 1 || !col.Exists("a") {
+		t.Fatal("records before the error were not imported")
+	}
+}
+
+func TestImportJSONNull(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+
+	res, err := col.ImportJSON(strings.NewReader(`[null,{"nwid":"a"},null]`), networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Records != 3 || res.Changed != 1 || col.Len() != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Index != 0 || !errors.Is(res.Errors[1], ErrNilValue) {
+		t.Fatalf("unexpected errors %v", res.Errors)
+	}
+}
+
+func TestImportCBORSeq(t *testing.T) {
+	var buf bytes.Buffer
+	enc := cbor.NewEncoder(&buf)
+	for i := range 600 {
+		if i == 300 {
+			enc.Encode("not a network")
+			continue
+		}
+		enc.Encode(&ZTNetwork{NWID: fmt.Sprintf("net-%d", i), MTU: i})
+	}
+
+	col := NewCollection[string, *ZTNetwork]()
+	res, err := col.ImportCBORSeq(&buf, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Records != 600 || res.Changed != 599 || col.Len() != 599 {
+		t.Fatalf("records %d, changed %d, len %d", res.Records, res.Changed, col.Len())
+	}
+	var typeErr *cbor.UnmarshalTypeError
+	if len(res.Errors) != 1 || res.Errors[0].Index != 300 || !errors.As(res.Errors[0], &typeErr) {
+		t.Fatalf("unexpected errors %v", res.Errors)
+	}
+
+	n, _ := col.Get("net-599")
+	if n.MTU != 599 {
+		t.Fatalf("MTU %d", n.MTU)
+	}
+}
@@ -0,0 +1,90 @@
+package syncmap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func fillCollection(n int) *Collection[string, *TestType] {
+	col := NewCollection[string, *TestType]()
+	for i := range n {
+		k := fmt.Sprintf("test-%d", i)
+		col.Add(k, &TestType{Field: k, Array: []int{i}})
+	}
+	return col
+}
+
+// Removing inside Iter() deadlocks on the read lock, IterSnapshot must not
+func TestIterSnapshotRemove(t *testing.T) {
+	col := fillCollection(100)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := range col.IterSnapshot() {
+			col.Remove(k)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("IterSnapshot deadlocked on Remove")
+	}
+
+	if col.Len() != 0 {
+		t.Fatalf("len %d, want 0", col.Len())
+	}
+}
+
+func TestIterSnapshotConcurrent(t *testing.T) {
+	col := fillCollection(100)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k, v := range col.IterSnapshot() {
+				col.Add(k+"-copy", v)
+				col.Remove(k)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRemoveIfRetain(t *testing.T) {
+	col := fillCollection(10)
+
+	n := col.RemoveIf(func(_ string, v *TestType) bool {
+		return v.Array[0]%2 == 0
+	})
+	if n != 5 || col.Len() != 5 {
+		t.Fatalf("RemoveIf removed %d, len %d", n, col.Len())
+	}
+
+	n = col.Retain(func(k string, _ *TestType) bool {
+		return k == "test-1"
+	})
+	if n != 4 || !col.Exists("test-1") {
+		t.Fatalf("Retain removed %d, len %d", n, col.Len())
+	}
+}
+
+func TestUpdateEach(t *testing.T) {
+	col := fillCollection(10)
+
+	col.UpdateEach(func(k string, v *TestType) *TestType {
+		return &TestType{Field: strings.ToUpper(k), Array: v.Array}
+	})
+
+	for k, v := range col.Iter() {
+		if v.Field != strings.ToUpper(k) {
+			t.Fatalf("%s not updated: %s", k, v.Field)
+		}
+	}
+}
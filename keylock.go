@@ -0,0 +1,88 @@
+package syncmap
+
+import (
+	"context"
+	"sync"
+)
+
+// ///////////////////////////
+// Per key locks
+// ///////////////////////////
+
+type keyLock struct {
+	sem  chan struct{}
+	refs int // holders and waiters
+}
+
+// keyLocks serializes work per key. Entries are reference counted and
+// removed once nobody holds or waits for them. The zero value is ready to use.
+type keyLocks[K MapKey] struct {
+	mu sync.Mutex
+	m  map[K]*keyLock
+}
+
+func (l *keyLocks[K]) acquire(ctx context.Context, key K) (unlock func(), err error) {
+	l.mu.Lock()
+	if l.m == nil {
+		l.m = make(map[K]*keyLock)
+	}
+	kl, ok := l.m[key]
+	if !ok {
+		kl = &keyLock{sem: make(chan struct{}, 1)}
+		l.m[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	select {
+	case kl.sem <- struct{}{}:
+	case <-ctx.Done():
+		l.release(key, kl)
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-kl.sem
+			l.release(key, kl)
+		})
+	}, nil
+}
+
+func (l *keyLocks[K]) release(key K, kl *keyLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kl.refs--
+	if kl.refs == 0 {
+		delete(l.m, key)
+	}
+}
+
+// len of the lock table
+func (l *keyLocks[_]) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.m)
+}
+
+// LockKey locks key without blocking other keys or the collection. Call
+// unlock when done, calling it more than once is a no-op
+func (c *Collection[K, _]) LockKey(key K) (unlock func()) {
+	unlock, _ = c.keys.acquire(context.Background(), key)
+	return unlock
+}
+
+// WithKey runs fn while holding the lock for key. Returns ctx.Err() if
+// the lock can't be acquired in time, otherwise the error from fn
+func (c *Collection[K, _]) WithKey(ctx context.Context, key K, fn func() error) error {
+	unlock, err := c.keys.acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
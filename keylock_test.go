@@ -0,0 +1,75 @@
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithKeySerializes(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+	col.Add("net", &ZTNetwork{NWID: "net"})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := col.WithKey(context.Background(), "net", func() error {
+				n, _ := col.Get("net")
+				next := *n
+				time.Sleep(time.Millisecond) // slow external call
+				next.Revision++
+				col.Add("net", &next)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, _ := col.Get("net")
+	if n.Revision != 20 {
+		t.Fatalf("revision %d, want 20", n.Revision)
+	}
+	if col.keys.len() != 0 {
+		t.Fatalf("lock table not cleaned up: %d entries", col.keys.len())
+	}
+}
+
+func TestLockKeyOtherKeys(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+
+	unlock := col.LockKey("a")
+	defer unlock()
+
+	// other keys and the collection itself are not blocked
+	done := make(chan struct{})
+	go func() {
+		col.LockKey("b")()
+		col.Add("a", &ZTNetwork{NWID: "a"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked by lock on another key")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := col.WithKey(ctx, "a", func() error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+
+	unlock()
+	unlock()
+	if col.keys.len() != 0 {
+		t.Fatalf("lock table not cleaned up: %d entries", col.keys.len())
+	}
+}
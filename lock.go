@@ -0,0 +1,336 @@
+package syncmap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ///////////////////////////
+// Context aware RWMutex
+// ///////////////////////////
+
+// rwMutex is a reader / writer lock whose acquisition can be abandoned
+// through a context. Waiting writers block new readers, like sync.RWMutex.
+// Readers take the lock with an atomic compare and swap while no writer
+// holds or waits for it, mu and wake are only used by writers and by
+// readers that have to wait.
+type rwMutex struct {
+	state atomic.Int64 // readers | waiting writers << 32 | writerHeld
+
+	mu   sync.Mutex
+	wake chan struct{} // closed on every state change, created lazily
+
+	holders  map[uint64][][]byte // goroutine id -> stacks, debug mode only
+	nholders atomic.Int32        // stacks in holders
+}
+
+const (
+	readerMask    = 1<<32 - 1
+	writerWaiting = 1 << 32
+	writerHeld    = 1 << 62
+)
+
+func newRWMutex() *rwMutex {
+	return &rwMutex{}
+}
+
+// LockReport describes a lock wait that passed the debug threshold
+type LockReport struct {
+	Write   bool
+	Waited  time.Duration
+	Holders [][]byte // stacks of the goroutines holding the lock
+}
+
+func (r LockReport) String() string {
+	mode := "read"
+	if r.Write {
+		mode = "write"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "syncmap: %s lock wait exceeded %s, held by %d goroutine(s)\n", mode, r.Waited, len(r.Holders))
+	for _, h := range r.Holders {
+		b.Write(h)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+type lockDebug struct {
+	threshold time.Duration
+	report    func(LockReport)
+}
+
+var lockDebugCfg atomic.Pointer[lockDebug]
+
+// SetLockDebug records the stack of every lock holder and calls report once
+// a wait for the lock passes threshold. A threshold <= 0 disables debug mode.
+// A nil report writes to stderr.
+func SetLockDebug(threshold time.Duration, report func(LockReport)) {
+	if threshold <= 0 {
+		lockDebugCfg.Store(nil)
+		return
+	}
+	if report == nil {
+		report = func(r LockReport) {
+			os.Stderr.WriteString(r.String())
+		}
+	}
+	lockDebugCfg.Store(&lockDebug{threshold: threshold, report: report})
+}
+
+func (m *rwMutex) Lock() {
+	m.lock(context.Background(), true)
+}
+
+func (m *rwMutex) RLock() {
+	m.lock(context.Background(), false)
+}
+
+// LockCtx acquires the write lock or returns ctx.Err()
+func (m *rwMutex) LockCtx(ctx context.Context) error {
+	return m.lock(ctx, true)
+}
+
+// RLockCtx acquires the read lock or returns ctx.Err()
+func (m *rwMutex) RLockCtx(ctx context.Context) error {
+	return m.lock(ctx, false)
+}
+
+func (m *rwMutex) lock(ctx context.Context, write bool) error {
+	checkAcquire(m, write)
+	dbg := lockDebugCfg.Load()
+
+	if !write {
+		if m.tryRLock() {
+			if dbg != nil {
+				m.addHolder()
+			}
+			trackAcquired(m, write)
+			return nil
+		}
+		m.undoRLock(false)
+	}
+
+	var (
+		start    time.Time
+		timer    *time.Timer
+		timeout  <-chan time.Time
+		reported bool
+		waiting  bool // write only, counted in state
+	)
+
+	m.mu.Lock()
+	for {
+		ok := write && m.tryLock(waiting)
+		if !write {
+			ok = m.tryRLock()
+			if !ok {
+				m.undoRLock(true)
+			}
+		}
+		if ok {
+			m.mu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			if dbg != nil {
+				m.addHolder()
+			}
+			trackAcquired(m, write)
+			return nil
+		}
+		if write && !waiting {
+			// block new readers, then check again so a reader that
+			// left in between isn't missed
+			m.state.Add(writerWaiting)
+			waiting = true
+			continue
+		}
+
+		if m.wake == nil {
+			m.wake = make(chan struct{})
+		}
+		wake := m.wake
+		m.mu.Unlock()
+
+		if dbg != nil && timer == nil {
+			start = time.Now()
+			timer = time.NewTimer(dbg.threshold)
+			timeout = timer.C
+		}
+
+		var err error
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			timeout = nil
+			if !reported {
+				reported = true
+				dbg.report(LockReport{Write: write, Waited: time.Since(start), Holders: m.holderStacks()})
+			}
+		}
+
+		m.mu.Lock()
+		if err != nil {
+			if waiting {
+				// readers may have been held back by this writer
+				m.state.Add(-writerWaiting)
+				m.broadcast()
+			}
+			m.mu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			return err
+		}
+	}
+}
+
+// tryRLock takes a read lock unless a writer holds or waits for the lock.
+// A failed attempt is undone with undoRLock
+func (m *rwMutex) tryRLock() bool {
+	return m.state.Add(1)&^readerMask == 0
+}
+
+// undoRLock takes back a failed tryRLock, waking the writers if the
+// attempt held them back. m.mu must be held if locked
+func (m *rwMutex) undoRLock(locked bool) {
+	s := m.state.Add(-1)
+	if s&readerMask != 0 || s&^readerMask == 0 {
+		return
+	}
+	if !locked {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+	}
+	m.broadcast()
+}
+
+// tryLock takes the write lock if it is free, waiting is true if the
+// caller is counted as a waiting writer. m.mu must be held
+func (m *rwMutex) tryLock(waiting bool) bool {
+	for {
+		s := m.state.Load()
+		if s&writerHeld != 0 || s&readerMask != 0 {
+			return false
+		}
+		n := s | writerHeld
+		if waiting {
+			n -= writerWaiting
+		}
+		if m.state.CompareAndSwap(s, n) {
+			return true
+		}
+	}
+}
+
+func (m *rwMutex) Unlock() {
+	m.removeHolder()
+	m.mu.Lock()
+	if m.state.Load()&writerHeld == 0 {
+		m.mu.Unlock()
+		panic("syncmap: Unlock of unlocked rwMutex")
+	}
+	m.state.Add(-writerHeld)
+	m.broadcast()
+	m.mu.Unlock()
+	trackReleased(m)
+}
+
+func (m *rwMutex) RUnlock() {
+	m.removeHolder()
+	s := m.state.Add(-1)
+	if uint32(s) == readerMask {
+		panic("syncmap: RUnlock of unlocked rwMutex")
+	}
+	if s&readerMask == 0 && s&^readerMask != 0 {
+		// last reader out, wake the waiting writers
+		m.mu.Lock()
+		m.broadcast()
+		m.mu.Unlock()
+	}
+	trackReleased(m)
+}
+
+// broadcast wakes all waiters, m.mu must be held
+func (m *rwMutex) broadcast() {
+	if m.wake != nil {
+		close(m.wake)
+		m.wake = nil
+	}
+}
+
+// addHolder records the calling goroutine's stack
+func (m *rwMutex) addHolder() {
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	id := stackGoID(buf)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.holders == nil {
+		m.holders = make(map[uint64][][]byte)
+	}
+	m.holders[id] = append(m.holders[id], buf)
+	m.nholders.Add(1)
+}
+
+// removeHolder forgets the calling goroutine's latest stack
+func (m *rwMutex) removeHolder() {
+	if m.nholders.Load() == 0 {
+		return
+	}
+	id := goID()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stacks := m.holders[id]
+	if len(stacks) == 0 {
+		return
+	}
+	if len(stacks) == 1 {
+		delete(m.holders, id)
+	} else {
+		m.holders[id] = stacks[:len(stacks)-1]
+	}
+	m.nholders.Add(-1)
+}
+
+func (m *rwMutex) holderStacks() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stacks := make([][]byte, 0, len(m.holders))
+	for _, s := range m.holders {
+		stacks = append(stacks, s...)
+	}
+	return stacks
+}
+
+// goID returns the id of the calling goroutine
+func goID() uint64 {
+	var buf [64]byte
+	return stackGoID(buf[:runtime.Stack(buf[:], false)])
+}
+
+// stackGoID parses the goroutine id from a "goroutine N [...]" stack header
+func stackGoID(stack []byte) uint64 {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		stack = stack[:i]
+	}
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
@@ -0,0 +1,237 @@
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCollectionCtxTimeout(t *testing.T) {
+	col := NewCollection[string, *TestType]()
+	col.Add("a", &TestType{Field: "a"})
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		for range col.Iter() {
+			close(held)
+			<-release
+		}
+	}()
+	<-held
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := col.AddCtx(ctx, "b", &TestType{Field: "b"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AddCtx: got %v, want deadline exceeded", err)
+	}
+	err = col.RemoveCtx(ctx, "a")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RemoveCtx: got %v, want deadline exceeded", err)
+	}
+
+	// a reader must not be blocked by the abandoned writers
+	_, ok, err := col.GetCtx(context.Background(), "a")
+	if err != nil || !ok {
+		t.Fatalf("GetCtx: ok=%v err=%v", ok, err)
+	}
+
+	close(release)
+
+	err = col.AddCtx(context.Background(), "b", &TestType{Field: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col.Len() != 2 {
+		t.Fatalf("len %d, want 2", col.Len())
+	}
+}
+
+func TestRWMutexWriterBlocksReaders(t *testing.T) {
+	m := newRWMutex()
+	m.RLock()
+
+	locked := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(locked)
+		m.Unlock()
+	}()
+
+	// wait for the writer to queue
+	for m.state.Load()&^readerMask == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.RLockCtx(ctx); err == nil {
+		t.Fatal("reader acquired lock while a writer was waiting")
+	}
+
+	m.RUnlock()
+	<-locked
+}
+
+func TestRWMutexConcurrent(t *testing.T) {
+	m := newRWMutex()
+	var (
+		wg sync.WaitGroup
+		n  int
+	)
+	for range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Lock()
+			n++
+			m.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			m.RLock()
+			_ = n
+			m.RUnlock()
+		}()
+	}
+	wg.Wait()
+	if n != 50 {
+		t.Fatalf("n = %d, want 50", n)
+	}
+}
+
+func TestLockDebugReport(t *testing.T) {
+	reports := make(chan LockReport, 1)
+	SetLockDebug(10*time.Millisecond, func(r LockReport) {
+		reports <- r
+	})
+	defer SetLockDebug(0, nil)
+
+	col := NewCollection[string, *TestType]()
+	col.Add("a", &TestType{Field: "a"})
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		for range col.Iter() {
+			close(held)
+			<-release
+		}
+	}()
+	<-held
+
+	done := make(chan struct{})
+	go func() {
+		col.Add("b", &TestType{Field: "b"})
+		close(done)
+	}()
+
+	r := <-reports
+	close(release)
+	<-done
+
+	if !r.Write || len(r.Holders) != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if !strings.Contains(string(r.Holders[0]), "TestLockDebugReport") {
+		t.Fatalf("holder stack does not point at the iterator:\n%s", r.Holders[0])
+	}
+}
+
+func TestLockDebugRecursiveRead(t *testing.T) {
+	reports := make(chan LockReport, 1)
+	SetLockDebug(10*time.Millisecond, func(r LockReport) {
+		reports <- r
+	})
+	defer SetLockDebug(0, nil)
+
+	m := newRWMutex()
+	m.RLock()
+	m.RLock()
+
+	done := make(chan struct{})
+	go func() {
+		m.Lock()
+		m.Unlock()
+		close(done)
+	}()
+
+	r := <-reports
+	if len(r.Holders) != 2 {
+		t.Fatalf("got %d holder stacks, want 2", len(r.Holders))
+	}
+	m.RUnlock()
+	m.RUnlock()
+	<-done
+
+	if n := len(m.holderStacks()); n != 0 {
+		t.Fatalf("%d holder stacks left", n)
+	}
+}
+
+func TestRWMutexReaderGivesUp(t *testing.T) {
+	m := newRWMutex()
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(locked)
+		<-release
+		m.Unlock()
+		close(done)
+	}()
+	<-locked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.RLockCtx(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	close(release)
+	<-done
+
+	// the abandoned reader left no trace
+	m.Lock()
+	m.Unlock()
+	if s := m.state.Load(); s != 0 {
+		t.Fatalf("state %#x after unlock", s)
+	}
+}
+
+func BenchmarkRWMutexRead(b *testing.B) {
+	b.Run("rwMutex", func(b *testing.B) {
+		m := newRWMutex()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				m.RLock()
+				m.RUnlock()
+			}
+		})
+	})
+	b.Run("sync.RWMutex", func(b *testing.B) {
+		var m sync.RWMutex
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				m.RLock()
+				m.RUnlock()
+			}
+		})
+	})
+}
+
+func BenchmarkCollectionGetParallel(b *testing.B) {
+	col := NewCollection[string, *TestType]()
+	col.Add("a", &TestType{Field: "a"})
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			col.Get("a")
+		}
+	})
+}
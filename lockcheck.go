@@ -0,0 +1,47 @@
+package syncmap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// ///////////////////////////
+// Lock misuse detection
+// ///////////////////////////
+// Build with -tags syncmapdebug to track which goroutines hold each
+// collection's lock. Reentrant acquisitions that would deadlock panic,
+// lock order inversions between collections are reported.
+
+// LockOrderReport describes two locks acquired in opposite orders
+type LockOrderReport struct {
+	First  []byte // stack that locked A then B
+	Second []byte // stack that locked B then A
+}
+
+func (r LockOrderReport) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "syncmap: lock order inversion between collections\n-- first order:\n%s\n-- opposite order:\n%s\n", r.First, r.Second)
+	return b.String()
+}
+
+var lockOrderReport atomic.Pointer[func(LockOrderReport)]
+
+// SetLockOrderReport sets the function called on a lock order inversion.
+// A nil report writes to stderr. Only used with -tags syncmapdebug.
+func SetLockOrderReport(report func(LockOrderReport)) {
+	if report == nil {
+		lockOrderReport.Store(nil)
+		return
+	}
+	lockOrderReport.Store(&report)
+}
+
+func reportLockOrder(r LockOrderReport) {
+	if fn := lockOrderReport.Load(); fn != nil {
+		(*fn)(r)
+		return
+	}
+	os.Stderr.WriteString(r.String())
+}
@@ -0,0 +1,7 @@
+//go:build !syncmapdebug
+
+package syncmap
+
+func checkAcquire(*rwMutex, bool)  {}
+func trackAcquired(*rwMutex, bool) {}
+func trackReleased(*rwMutex)       {}
@@ -0,0 +1,96 @@
+//go:build syncmapdebug
+
+package syncmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+type heldLock struct {
+	m     *rwMutex
+	write bool
+}
+
+type lockEdge struct {
+	from, to *rwMutex
+}
+
+var lockTrack = struct {
+	sync.Mutex
+	held     map[uint64][]heldLock // goroutine id -> locks in acquisition order
+	edges    map[lockEdge][]byte   // observed order -> first stack
+	reported map[lockEdge]bool
+}{
+	held:     make(map[uint64][]heldLock),
+	edges:    make(map[lockEdge][]byte),
+	reported: make(map[lockEdge]bool),
+}
+
+// checkAcquire panics if the calling goroutine already holds m in a mode
+// that makes this acquisition deadlock, and reports lock order inversions
+func checkAcquire(m *rwMutex, write bool) {
+	gid := goID()
+
+	lockTrack.Lock()
+	defer lockTrack.Unlock()
+
+	var stack []byte
+	for _, h := range lockTrack.held[gid] {
+		if h.m == m {
+			switch {
+			case h.write:
+				panic("syncmap: reentrant lock, collection is already write locked by this goroutine")
+			case write:
+				panic("syncmap: reentrant write after read, collection is read locked by this goroutine (modifying inside Iter() or a callback?)")
+			}
+			continue
+		}
+
+		if stack == nil {
+			stack = callerStack()
+		}
+		if _, ok := lockTrack.edges[lockEdge{h.m, m}]; !ok {
+			lockTrack.edges[lockEdge{h.m, m}] = stack
+		}
+		if first, ok := lockTrack.edges[lockEdge{m, h.m}]; ok && !lockTrack.reported[lockEdge{m, h.m}] {
+			lockTrack.reported[lockEdge{m, h.m}] = true
+			lockTrack.reported[lockEdge{h.m, m}] = true
+			reportLockOrder(LockOrderReport{First: first, Second: stack})
+		}
+	}
+}
+
+func trackAcquired(m *rwMutex, write bool) {
+	gid := goID()
+
+	lockTrack.Lock()
+	defer lockTrack.Unlock()
+
+	lockTrack.held[gid] = append(lockTrack.held[gid], heldLock{m: m, write: write})
+}
+
+func trackReleased(m *rwMutex) {
+	gid := goID()
+
+	lockTrack.Lock()
+	defer lockTrack.Unlock()
+
+	held := lockTrack.held[gid]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i].m == m {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(lockTrack.held, gid)
+		return
+	}
+	lockTrack.held[gid] = held
+}
+
+func callerStack() []byte {
+	buf := make([]byte, 4096)
+	return buf[:runtime.Stack(buf, false)]
+}
@@ -0,0 +1,83 @@
+//go:build syncmapdebug
+
+package syncmap
+
+import (
+	"strings"
+	"testing"
+)
+
+func expectPanic(t *testing.T, want string, fn func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected panic")
+		}
+		if !strings.Contains(r.(string), want) {
+			t.Fatalf("panic %q does not contain %q", r, want)
+		}
+	}()
+	fn()
+}
+
+func TestDebugAddInsideIter(t *testing.T) {
+	col := NewCollection[string, *TestType]()
+	col.Add("a", &TestType{Field: "a"})
+
+	expectPanic(t, "write after read", func() {
+		for k, v := range col.Iter() {
+			col.Add(k+"-copy", v)
+		}
+	})
+
+	// the iterator's read lock was released by the deferred RUnlock
+	col.Add("b", &TestType{Field: "b"})
+}
+
+func TestDebugReentrantWrite(t *testing.T) {
+	col := NewCollection[string, *TestType]()
+	col.Add("a", &TestType{Field: "a"})
+
+	expectPanic(t, "already write locked", func() {
+		col.UpdateEach(func(k string, v *TestType) *TestType {
+			col.Exists(k)
+			return v
+		})
+	})
+}
+
+func TestDebugLockOrderInversion(t *testing.T) {
+	var reports []LockOrderReport
+	SetLockOrderReport(func(r LockOrderReport) {
+		reports = append(reports, r)
+	})
+	defer SetLockOrderReport(nil)
+
+	a := NewCollection[string, *TestType]()
+	b := NewCollection[string, *TestType]()
+	a.Add("a", &TestType{Field: "a"})
+	b.Add("b", &TestType{Field: "b"})
+
+	for range a.Iter() {
+		b.Len()
+	}
+	if len(reports) != 0 {
+		t.Fatalf("unexpected report for consistent order")
+	}
+
+	for range b.Iter() {
+		a.Len()
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+
+	// reported once per pair
+	for range b.Iter() {
+		a.Len()
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+}
@@ -0,0 +1,126 @@
+package syncmap
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// ///////////////////////////
+// Merkle tree
+// ///////////////////////////
+// Keys are spread over 16^depth leaf buckets by the hash of their canonical
+// CBOR encoding. A leaf is the XOR of the hashes of its entries, so entries
+// are added and removed without visiting the others. Inner nodes hash their
+// 16 children and are updated along the path of each change.
+
+const merkleFanout = 16
+
+type merkleTree[K MapKey] struct {
+	depth  int
+	levels [][]Digest       // levels[0] is the root, levels[depth] the leaves
+	keys   []map[K]struct{} // keys per leaf, nil if empty
+}
+
+func newMerkleTree[K MapKey](depth int) *merkleTree[K] {
+	t := &merkleTree[K]{depth: depth, levels: make([][]Digest, depth+1)}
+	n := 1
+	for l := range t.levels {
+		t.levels[l] = make([]Digest, n)
+		n *= merkleFanout
+	}
+	t.keys = make([]map[K]struct{}, len(t.levels[depth]))
+
+	// hash the empty inner nodes
+	for l := depth - 1; l >= 0; l-- {
+		for i := range t.levels[l] {
+			t.levels[l][i] = t.hashChildren(l, i)
+		}
+	}
+	return t
+}
+
+// keyBytes is the canonical CBOR of k, its formatted value if it can't be encoded
+func keyBytes[K MapKey](k K) []byte {
+	b, err := canonicalEnc.Marshal(k)
+	if err != nil {
+		return []byte(fmt.Sprint(k))
+	}
+	return b
+}
+
+// bucket returns the leaf index of k
+func (t *merkleTree[K]) bucket(k K) int {
+	return bucketOf(sha256.Sum256(keyBytes(k)), t.depth)
+}
+
+func bucketOf(h Digest, depth int) (leaf int) {
+	// 4 bits per level
+	for l := range depth {
+		nibble := h[l/2] >> 4
+		if l%2 == 1 {
+			nibble = h[l/2] & 0xf
+		}
+		leaf = leaf*merkleFanout + int(nibble)
+	}
+	return leaf
+}
+
+// entryHash binds the value digest to its key
+func entryHash[K MapKey](k K, d Digest) Digest {
+	h := sha256.New()
+	h.Write(keyBytes(k))
+	h.Write(d[:])
+	return Digest(h.Sum(nil))
+}
+
+func (t *merkleTree[K]) add(k K, d Digest) {
+	leaf := t.bucket(k)
+	if t.keys[leaf] == nil {
+		t.keys[leaf] = make(map[K]struct{})
+	}
+	t.keys[leaf][k] = struct{}{}
+	t.toggle(leaf, entryHash(k, d))
+}
+
+func (t *merkleTree[K]) remove(k K, d Digest) {
+	leaf := t.bucket(k)
+	delete(t.keys[leaf], k)
+	if len(t.keys[leaf]) == 0 {
+		t.keys[leaf] = nil
+	}
+	t.toggle(leaf, entryHash(k, d))
+}
+
+// toggle XORs h into leaf and rehashes its ancestors
+func (t *merkleTree[K]) toggle(leaf int, h Digest) {
+	node := &t.levels[t.depth][leaf]
+	for i := range node {
+		node[i] ^= h[i]
+	}
+
+	i := leaf
+	for l := t.depth - 1; l >= 0; l-- {
+		i /= merkleFanout
+		t.levels[l][i] = t.hashChildren(l, i)
+	}
+}
+
+func (t *merkleTree[K]) hashChildren(level, i int) Digest {
+	h := sha256.New()
+	for _, c := range t.levels[level+1][i*merkleFanout : (i+1)*merkleFanout] {
+		h.Write(c[:])
+	}
+	return Digest(h.Sum(nil))
+}
+
+// MerkleRoot returns the root hash of the Merkle tree, equal roots mean
+// equal contents. ok is false without WithMerkleTree
+func (c *Collection[_, _]) MerkleRoot() (root Digest, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if c.tree == nil {
+		return root, false
+	}
+	return c.tree.levels[0][0], true
+}
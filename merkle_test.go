@@ -0,0 +1,151 @@
+package syncmap
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"testing"
+)
+
+func peerCollection(n int) *Collection[string, *ZTPeerID] {
+	col := NewCollection[string, *ZTPeerID](WithMerkleTree(2))
+	for i := range n {
+		k := fmt.Sprint("peer-", i)
+		col.Add(k, &ZTPeerID{ID: k, Address: fmt.Sprint("10.1.", i/256, ".", i%256)})
+	}
+	return col
+}
+
+func TestMerkleIncremental(t *testing.T) {
+	col := peerCollection(200)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 500 {
+		k := fmt.Sprint("peer-", rng.IntN(300))
+		switch rng.IntN(3) {
+		case 0:
+			col.Add(k, &ZTPeerID{ID: k, Address: fmt.Sprint(rng.Int())})
+		case 1:
+			col.Remove(k)
+		case 2:
+			col.Delete(k)
+		}
+	}
+
+	rebuilt := NewCollection[string, *ZTPeerID](WithMerkleTree(2))
+	rebuilt.Set(col.Snapshot().(mapView[string, *ZTPeerID]))
+
+	a, _ := col.MerkleRoot()
+	b, _ := rebuilt.MerkleRoot()
+	if a != b {
+		t.Fatal("incremental root differs from rebuilt root")
+	}
+
+	empty := NewCollection[string, *ZTPeerID](WithMerkleTree(2))
+	if e, _ := empty.MerkleRoot(); e == a {
+		t.Fatal("root of empty collection matches")
+	}
+	if _, ok := NewCollection[string, *ZTPeerID]().MerkleRoot(); ok {
+		t.Fatal("root without tree")
+	}
+}
+
+func syncPipe(t *testing.T, local, remote *Collection[string, *ZTPeerID]) MerkleSyncResult {
+	t.Helper()
+
+	a, b := net.Pipe()
+	defer a.Close()
+	served := make(chan error, 1)
+	go func() {
+		defer b.Close()
+		served <- remote.ServeMerkle(b)
+	}()
+
+	r, err := local.SyncMerkle(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSyncMerkle(t *testing.T) {
+	local := peerCollection(1000)
+	remote := peerCollection(1000)
+
+	remote.Add("peer-1", &ZTPeerID{ID: "peer-1", Address: "changed"})
+	remote.Add("peer-2", &ZTPeerID{ID: "peer-2", Address: "changed"})
+	remote.Add("new-1", &ZTPeerID{ID: "new-1"})
+	remote.Remove("peer-3")
+	local.Add("local-only", &ZTPeerID{ID: "local-only"})
+
+	r := syncPipe(t, local, remote)
+	if r.Updated != 3 || r.Removed != 2 {
+		t.Fatalf("updated %d removed %d, want 3 and 2", r.Updated, r.Removed)
+	}
+	if r.Received > 50 {
+		t.Fatalf("%d entries transferred for 5 differences", r.Received)
+	}
+	if !Diff[string, *ZTPeerID](remote, local).Empty() {
+		t.Fatal("collections differ after sync")
+	}
+	a, _ := local.MerkleRoot()
+	b, _ := remote.MerkleRoot()
+	if a != b {
+		t.Fatal("roots differ after sync")
+	}
+
+	r = syncPipe(t, local, remote)
+	if r.Rounds != 1 || r.Buckets != 0 || r.Received != 0 {
+		t.Fatalf("in sync collections exchanged %+v", r)
+	}
+}
+
+func TestSyncMerkleChunks(t *testing.T) {
+	defer func(n int) { merkleChunk = n }(merkleChunk)
+	merkleChunk = 5
+
+	local := peerCollection(10)
+	remote := peerCollection(1000)
+	r := syncPipe(t, local, remote)
+	// 1 root, 16 level 1 and 256 leaf hashes in chunks of 5
+	if r.Rounds != 1+4+52 || r.Received != 1000 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if !Diff[string, *ZTPeerID](remote, local).Empty() {
+		t.Fatal("collections differ after sync")
+	}
+}
+
+func TestSyncMerkleLarge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large sync")
+	}
+
+	// more entries than a CBOR array may hold by default
+	local := NewCollection[string, *ZTPeerID](WithMerkleTree(2))
+	remote := peerCollection(140_000)
+	r := syncPipe(t, local, remote)
+	if r.Received != 140_000 || local.Len() != 140_000 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
+
+func TestSyncMerkleErrors(t *testing.T) {
+	plain := NewCollection[string, *ZTPeerID]()
+	if _, err := plain.SyncMerkle(nil); !errors.Is(err, ErrNoMerkleTree) {
+		t.Fatalf("got %v, want ErrNoMerkleTree", err)
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	go func() {
+		defer b.Close()
+		NewCollection[string, *ZTPeerID](WithMerkleTree(3)).ServeMerkle(b)
+	}()
+	if _, err := peerCollection(1).SyncMerkle(a); err == nil {
+		t.Fatal("depth mismatch not detected")
+	}
+}
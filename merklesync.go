@@ -0,0 +1,276 @@
+package syncmap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ///////////////////////////
+// Merkle sync
+// ///////////////////////////
+// SyncMerkle walks the trees of both sides from the root, asking the peer
+// only for the children of nodes that differ, then fetches the entries of
+// the differing leaf buckets. Messages are CBOR encoded back to back,
+// nodes and entries are sent in chunks of merkleChunk to stay below the
+// array limits of the decoder.
+
+// ErrNoMerkleTree is returned when syncing a collection created without WithMerkleTree
+var ErrNoMerkleTree = errors.New("syncmap: collection has no merkle tree")
+
+type merkleOp uint8
+
+const (
+	merkleHello   merkleOp = iota + 1 // Depth of the tree
+	merkleHashes                      // hashes of Nodes on Level
+	merkleEntries                     // entries of the leaf buckets in Nodes, More if another reply follows
+	merkleDone
+)
+
+// merkleChunk caps the nodes of a request and the entries of a reply
+var merkleChunk = 4096
+
+type merkleMsg[K MapKey, V any] struct {
+	Op      merkleOp      `cbor:"1,keyasint"`
+	Depth   int           `cbor:"2,keyasint,omitempty"`
+	Level   int           `cbor:"3,keyasint,omitempty"`
+	Nodes   []int         `cbor:"4,keyasint,omitempty"`
+	Hashes  []Digest      `cbor:"5,keyasint,omitempty"`
+	Entries []Entry[K, V] `cbor:"6,keyasint,omitempty"`
+	Err     string        `cbor:"7,keyasint,omitempty"`
+	More    bool          `cbor:"8,keyasint,omitempty"`
+}
+
+// MerkleSyncResult counts the work of a SyncMerkle
+type MerkleSyncResult struct {
+	Rounds   int // hash requests
+	Buckets  int // leaf buckets that differed
+	Received int // entries transferred
+	Updated  int // entries added or changed
+	Removed  int // entries missing on the peer
+}
+
+// merkleDepth is 0 without a tree
+func (c *Collection[_, _]) merkleDepth() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if c.tree == nil {
+		return 0
+	}
+	return c.tree.depth
+}
+
+func (c *Collection[_, _]) merkleHashes(level int, nodes []int) ([]Digest, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if level < 0 || level > c.tree.depth {
+		return nil, fmt.Errorf("syncmap: no merkle level %d", level)
+	}
+	hashes := make([]Digest, len(nodes))
+	for i, n := range nodes {
+		if n < 0 || n >= len(c.tree.levels[level]) {
+			return nil, fmt.Errorf("syncmap: no merkle node %d on level %d", n, level)
+		}
+		hashes[i] = c.tree.levels[level][n]
+	}
+	return hashes, nil
+}
+
+func (c *Collection[K, V]) bucketEntries(buckets []int) ([]Entry[K, V], error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var entries []Entry[K, V]
+	for _, b := range buckets {
+		if b < 0 || b >= len(c.tree.keys) {
+			return nil, fmt.Errorf("syncmap: no merkle bucket %d", b)
+		}
+		for k := range c.tree.keys[b] {
+			entries = append(entries, Entry[K, V]{Key: k, Rev: c.revs[k], Value: c.m[k]})
+		}
+	}
+	return entries, nil
+}
+
+// ServeMerkle answers the SyncMerkle of a peer on rw until it's done
+func (c *Collection[K, V]) ServeMerkle(rw io.ReadWriter) error {
+	depth := c.merkleDepth()
+	enc := canonicalEnc.NewEncoder(rw)
+	dec := cbor.NewDecoder(rw)
+
+	for {
+		var req merkleMsg[K, V]
+		err := dec.Decode(&req)
+		if err != nil {
+			return err
+		}
+
+		var resp merkleMsg[K, V]
+		switch {
+		case req.Op == merkleDone:
+			return nil
+		case req.Op == merkleHello:
+			resp.Depth = depth
+		case depth == 0:
+			return ErrNoMerkleTree
+		case req.Op == merkleHashes:
+			resp.Hashes, err = c.merkleHashes(req.Level, req.Nodes)
+		case req.Op == merkleEntries:
+			resp.Entries, err = c.bucketEntries(req.Nodes)
+		default:
+			err = fmt.Errorf("syncmap: unknown merkle op %d", req.Op)
+		}
+		resp.Op = req.Op
+		if err != nil {
+			resp.Err = err.Error()
+		}
+
+		err = sendMerkle(enc, resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sendMerkle encodes resp, splitting its entries into replies of merkleChunk
+func sendMerkle[K MapKey, V any](enc *cbor.Encoder, resp merkleMsg[K, V]) error {
+	entries := resp.Entries
+	for len(entries) > merkleChunk {
+		resp.Entries, resp.More = entries[:merkleChunk], true
+		err := enc.Encode(&resp)
+		if err != nil {
+			return err
+		}
+		entries = entries[merkleChunk:]
+	}
+	resp.Entries, resp.More = entries, false
+	return enc.Encode(&resp)
+}
+
+// SyncMerkle makes c match the peer serving ServeMerkle on rw. Only the
+// entries of differing buckets are transferred, they are added or
+// replaced and keys missing on the peer are removed
+func (c *Collection[K, V]) SyncMerkle(rw io.ReadWriter) (r MerkleSyncResult, err error) {
+	depth := c.merkleDepth()
+	if depth == 0 {
+		return r, ErrNoMerkleTree
+	}
+
+	enc := canonicalEnc.NewEncoder(rw)
+	dec := cbor.NewDecoder(rw)
+	call := func(req merkleMsg[K, V]) (resp merkleMsg[K, V], err error) {
+		err = enc.Encode(&req)
+		if err != nil {
+			return resp, err
+		}
+		for more := true; more; more = resp.More {
+			var next merkleMsg[K, V]
+			err = dec.Decode(&next)
+			if err != nil {
+				return resp, err
+			}
+			if next.Err != "" {
+				return resp, fmt.Errorf("syncmap: merkle peer: %s", next.Err)
+			}
+			next.Entries = append(resp.Entries, next.Entries...)
+			resp = next
+		}
+		return resp, nil
+	}
+
+	resp, err := call(merkleMsg[K, V]{Op: merkleHello})
+	if err != nil {
+		return r, err
+	}
+	if resp.Depth != depth {
+		return r, fmt.Errorf("syncmap: merkle depth %d, peer has %d", depth, resp.Depth)
+	}
+
+	nodes := []int{0}
+	for level := 0; ; level++ {
+		remote := make([]Digest, 0, len(nodes))
+		for chunk := range slices.Chunk(nodes, merkleChunk) {
+			resp, err = call(merkleMsg[K, V]{Op: merkleHashes, Level: level, Nodes: chunk})
+			if err != nil {
+				return r, err
+			}
+			r.Rounds++
+			if len(resp.Hashes) != len(chunk) {
+				return r, fmt.Errorf("syncmap: merkle peer sent %d hashes for %d nodes", len(resp.Hashes), len(chunk))
+			}
+			remote = append(remote, resp.Hashes...)
+		}
+
+		local, err := c.merkleHashes(level, nodes)
+		if err != nil {
+			return r, err
+		}
+
+		var diff []int
+		for i, n := range nodes {
+			if local[i] != remote[i] {
+				diff = append(diff, n)
+			}
+		}
+		if len(diff) == 0 {
+			return r, enc.Encode(&merkleMsg[K, V]{Op: merkleDone})
+		}
+		if level == depth {
+			nodes = diff
+			break
+		}
+
+		nodes = nodes[:0]
+		for _, n := range diff {
+			for i := range merkleFanout {
+				nodes = append(nodes, n*merkleFanout+i)
+			}
+		}
+	}
+
+	var entries []Entry[K, V]
+	for chunk := range slices.Chunk(nodes, merkleChunk) {
+		resp, err = call(merkleMsg[K, V]{Op: merkleEntries, Nodes: chunk})
+		if err != nil {
+			return r, err
+		}
+		entries = append(entries, resp.Entries...)
+	}
+	r.Buckets = len(nodes)
+	r.Received = len(entries)
+	r.Updated, r.Removed = c.repair(nodes, entries)
+
+	return r, enc.Encode(&merkleMsg[K, V]{Op: merkleDone})
+}
+
+// repair replaces the contents of buckets with entries
+func (c *Collection[K, V]) repair(buckets []int, entries []Entry[K, V]) (updated, removed int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	remote := make(map[K]struct{}, len(entries))
+	for _, e := range entries {
+		remote[e.Key] = struct{}{}
+		if c.store(e.Key, e.Value) {
+			updated++
+		}
+	}
+
+	var stale []K
+	for _, b := range buckets {
+		for k := range c.tree.keys[b] {
+			if _, ok := remote[k]; !ok {
+				stale = append(stale, k)
+			}
+		}
+	}
+	for _, k := range stale {
+		c.drop(k)
+	}
+	return updated, len(stale)
+}
@@ -0,0 +1,42 @@
+package syncmap
+
+// ///////////////////////////
+// Collection options
+// ///////////////////////////
+
+type options struct {
+	digest      bool
+	changeLog   int
+	merkleDepth int
+}
+
+// Option configures a collection
+type Option func(*options)
+
+// WithDigest keeps a content digest per entry. Add then reports a change
+// only when the digest differs and Digest(k) becomes available
+func WithDigest() Option {
+	return func(o *options) {
+		o.digest = true
+	}
+}
+
+// WithChangeLog keeps the last size change events, so subscribers can
+// resume from a revision with SubscribeSince
+func WithChangeLog(size int) Option {
+	return func(o *options) {
+		o.changeLog = size
+	}
+}
+
+// WithMerkleTree keeps a Merkle tree over the entry digests for
+// SyncMerkle, implies WithDigest. The tree has depth levels below the
+// root with 16 children each, depth 0 uses 3 (4096 buckets)
+func WithMerkleTree(depth int) Option {
+	return func(o *options) {
+		if depth <= 0 {
+			depth = 3
+		}
+		o.merkleDepth = depth
+	}
+}
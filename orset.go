@@ -0,0 +1,330 @@
+package syncmap
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+	"strconv"
+)
+
+/////////////////////////////
+// OR-Set
+/////////////////////////////
+
+// Dot tags one add, Seq counts the adds of Node
+type Dot struct {
+	Node string `json:"node" cbor:"n"`
+	Seq  uint64 `json:"seq" cbor:"s"`
+}
+
+func compareDots(a, b Dot) int {
+	if c := cmp.Compare(a.Node, b.Node); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Seq, b.Seq)
+}
+
+// ORSetAdd is an element with the tag of its add
+type ORSetAdd[K PointerType] struct {
+	Dot  Dot `json:"dot" cbor:"t"`
+	Elem K   `json:"elem" cbor:"e"`
+}
+
+// ORSetState is the state of an ORSet or a delta of it. Version and Dots
+// are the causal context, the adds seen: every Seq up to Version[node]
+// plus the single Dots
+type ORSetState[K PointerType] struct {
+	Adds    []ORSetAdd[K]     `json:"adds" cbor:"a"`
+	Version map[string]uint64 `json:"version" cbor:"v"`
+	Dots    []Dot             `json:"dots,omitempty" cbor:"d,omitempty"`
+}
+
+// causalContext is a version vector plus the dots beyond it
+type causalContext struct {
+	vv    map[string]uint64
+	cloud map[Dot]struct{}
+}
+
+func newCausalContext() causalContext {
+	return causalContext{vv: make(map[string]uint64), cloud: make(map[Dot]struct{})}
+}
+
+func (c causalContext) contains(d Dot) bool {
+	if d.Seq <= c.vv[d.Node] {
+		return true
+	}
+	_, ok := c.cloud[d]
+	return ok
+}
+
+func (c causalContext) add(d Dot) {
+	if !c.contains(d) {
+		c.cloud[d] = struct{}{}
+	}
+}
+
+func (c causalContext) merge(o causalContext) {
+	for n, seq := range o.vv {
+		c.vv[n] = max(c.vv[n], seq)
+	}
+	for d := range o.cloud {
+		c.add(d)
+	}
+	c.compact()
+}
+
+// compact folds the dots that continue the version vector into it
+func (c causalContext) compact() {
+	if len(c.cloud) == 0 {
+		return
+	}
+	dots := make([]Dot, 0, len(c.cloud))
+	for d := range c.cloud {
+		dots = append(dots, d)
+	}
+	slices.SortFunc(dots, compareDots)
+
+	for _, d := range dots {
+		switch {
+		case d.Seq <= c.vv[d.Node]:
+			delete(c.cloud, d)
+		case d.Seq == c.vv[d.Node]+1:
+			c.vv[d.Node] = d.Seq
+			delete(c.cloud, d)
+		}
+	}
+}
+
+// orState holds the live dots per element ID and the causal context
+type orState[K PointerType] struct {
+	entries map[string]map[Dot]K
+	cc      causalContext
+}
+
+func newORState[K PointerType]() *orState[K] {
+	return &orState[K]{entries: make(map[string]map[Dot]K), cc: newCausalContext()}
+}
+
+// join merges r into s: dots both hold, plus dots only one holds that
+// the other hasn't seen
+func (s *orState[K]) join(r *orState[K]) {
+	for id, dots := range s.entries {
+		rdots := r.entries[id]
+		for d := range dots {
+			if _, ok := rdots[d]; !ok && r.cc.contains(d) {
+				delete(dots, d)
+			}
+		}
+		if len(dots) == 0 {
+			delete(s.entries, id)
+		}
+	}
+
+	for id, rdots := range r.entries {
+		for d, k := range rdots {
+			if _, ok := s.entries[id][d]; ok || s.cc.contains(d) {
+				continue
+			}
+			if s.entries[id] == nil {
+				s.entries[id] = make(map[Dot]K)
+			}
+			s.entries[id][d] = k
+		}
+	}
+
+	s.cc.merge(r.cc)
+}
+
+// elem returns the element of the greatest dot, so replicas agree on it
+func elem[K PointerType](dots map[Dot]K) (k K) {
+	var best Dot
+	for d, e := range dots {
+		if compareDots(d, best) > 0 {
+			best, k = d, e
+		}
+	}
+	return k
+}
+
+func (s *orState[K]) export() ORSetState[K] {
+	st := ORSetState[K]{Version: make(map[string]uint64, len(s.cc.vv))}
+	for _, dots := range s.entries {
+		for d, k := range dots {
+			st.Adds = append(st.Adds, ORSetAdd[K]{Dot: d, Elem: k})
+		}
+	}
+	for n, seq := range s.cc.vv {
+		st.Version[n] = seq
+	}
+	for d := range s.cc.cloud {
+		st.Dots = append(st.Dots, d)
+	}
+	return st
+}
+
+func importORState[K PointerType](st ORSetState[K]) *orState[K] {
+	s := newORState[K]()
+	for _, a := range st.Adds {
+		id := a.Elem.GetID()
+		if s.entries[id] == nil {
+			s.entries[id] = make(map[Dot]K)
+		}
+		s.entries[id][a.Dot] = a.Elem
+	}
+	for n, seq := range st.Version {
+		s.cc.vv[n] = seq
+	}
+	for _, d := range st.Dots {
+		s.cc.add(d)
+	}
+	s.cc.compact()
+	return s
+}
+
+// ORSet is an observed remove set of elements identified by GetID that
+// replicas edit independently. A remove only cancels the adds its replica
+// has seen, so a concurrent add wins. Changes are collected into a delta
+// for cheap gossip, see Delta and MergeState
+type ORSet[K PointerType] struct {
+	mtx   *rwMutex
+	node  string
+	s     *orState[K]
+	delta *orState[K] // changes since the last Delta
+}
+
+// NewORSet creates new empty set for node, node must be unique among the replicas
+func NewORSet[K PointerType](node string) *ORSet[K] {
+	var s ORSet[K]
+	return newORSet(&s, node)
+}
+
+func newORSet[K PointerType](s *ORSet[K], node string) *ORSet[K] {
+	s.mtx = newRWMutex()
+	s.node = node
+	s.s = newORState[K]()
+	s.delta = newORState[K]()
+	return s
+}
+
+// Exists check if an element with the ID of key exists
+func (m *ORSet[K]) Exists(key K) (ok bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	_, ok = m.s.entries[key.GetID()]
+	return ok
+}
+
+// Add key with a new tag, replacing the element with the same ID
+func (m *ORSet[K]) Add(key K) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	id := key.GetID()
+	d := Dot{Node: m.node, Seq: m.s.cc.vv[m.node] + 1}
+
+	delta := newORState[K]()
+	for old := range m.s.entries[id] {
+		delta.cc.add(old)
+	}
+	delta.cc.add(d)
+	delta.entries[id] = map[Dot]K{d: key}
+
+	m.s.join(delta)
+	m.delta.join(delta)
+}
+
+// Remove the element with the ID of key, cancelling the adds seen so far
+func (m *ORSet[K]) Remove(key K) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	dots, ok := m.s.entries[key.GetID()]
+	if !ok {
+		return
+	}
+	delta := newORState[K]()
+	for d := range dots {
+		delta.cc.add(d)
+	}
+
+	m.s.join(delta)
+	m.delta.join(delta)
+}
+
+func (m *ORSet[_]) Len() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return len(m.s.entries)
+}
+
+func (m *ORSet[_]) LenStr() string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return strconv.Itoa(len(m.s.entries))
+}
+
+// All iterates over the elements of K
+func (m *ORSet[K]) All() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+
+		for _, dots := range m.s.entries {
+			if !yield(elem(dots)) {
+				return
+			}
+		}
+	}
+}
+
+func (m *ORSet[K]) GetByID(id string) (k K) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return elem(m.s.entries[id])
+}
+
+// State returns the full state, for MergeState on another replica
+func (m *ORSet[K]) State() ORSetState[K] {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.s.export()
+}
+
+// Delta returns the local changes made since the last call and starts a
+// new delta, ok is false if there were none. Merged changes aren't
+// included, so send it to every replica. Deltas can be merged in any
+// order and more than once, a lost delta is repaired by a later State
+func (m *ORSet[K]) Delta() (d ORSetState[K], ok bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if len(m.delta.entries) == 0 && len(m.delta.cc.vv) == 0 && len(m.delta.cc.cloud) == 0 {
+		return d, false
+	}
+	d = m.delta.export()
+	m.delta = newORState[K]()
+	return d, true
+}
+
+// MergeState joins a state or delta of another replica
+func (m *ORSet[K]) MergeState(st ORSetState[K]) {
+	r := importORState(st)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.s.join(r)
+}
+
+// Merge joins the state of other
+func (m *ORSet[K]) Merge(other *ORSet[K]) {
+	if other == m {
+		return
+	}
+	m.MergeState(other.State())
+}
@@ -0,0 +1,169 @@
+package syncmap
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type setMember struct {
+	ID   string `cbor:"id"`
+	Note string `cbor:"note"`
+}
+
+func (m *setMember) GetID() string { return m.ID }
+
+// members lists the ID and note of each element in ID order
+func members(s *ORSet[*setMember]) (out []string) {
+	for m := range s.All() {
+		out = append(out, m.ID+"="+m.Note)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestORSetAddWins(t *testing.T) {
+	a := NewORSet[*setMember]("a")
+	b := NewORSet[*setMember]("b")
+
+	a.Add(&setMember{ID: "x", Note: "a"})
+	b.Merge(a)
+	if !b.Exists(&setMember{ID: "x"}) {
+		t.Fatal("add not merged")
+	}
+
+	// concurrent remove and add
+	a.Remove(&setMember{ID: "x"})
+	b.Add(&setMember{ID: "x", Note: "b"})
+	a.Merge(b)
+	b.Merge(a)
+
+	for _, s := range []*ORSet[*setMember]{a, b} {
+		if m := s.GetByID("x"); m == nil || m.Note != "b" {
+			t.Fatalf("concurrent add lost, got %v", m)
+		}
+	}
+
+	// a remove that saw the add wins
+	b.Remove(&setMember{ID: "x"})
+	a.Merge(b)
+	if a.Exists(&setMember{ID: "x"}) || a.Len() != 0 {
+		t.Fatal("observed remove not merged")
+	}
+}
+
+func TestORSetDelta(t *testing.T) {
+	a := NewORSet[*setMember]("a")
+	b := NewORSet[*setMember]("b")
+
+	if _, ok := a.Delta(); ok {
+		t.Fatal("delta without changes")
+	}
+	for i := range 5 {
+		a.Add(&setMember{ID: fmt.Sprint(i)})
+	}
+	a.Remove(&setMember{ID: "0"})
+
+	d, ok := a.Delta()
+	if !ok || len(d.Adds) != 4 {
+		t.Fatalf("delta %+v", d)
+	}
+	if _, ok := a.Delta(); ok {
+		t.Fatal("delta not drained")
+	}
+
+	// over the wire
+	raw, err := canonicalEnc.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ORSetState[*setMember]
+	if err := cbor.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	b.MergeState(decoded)
+	if !slices.Equal(members(a), members(b)) {
+		t.Fatalf("%v != %v", members(a), members(b))
+	}
+
+	// compacted into the version vector
+	st := b.State()
+	if len(st.Dots) != 0 || st.Version["a"] != 5 {
+		t.Fatalf("context not compacted %+v %+v", st.Version, st.Dots)
+	}
+}
+
+func TestORSetConvergence(t *testing.T) {
+	prop := func(seed uint64) bool {
+		rng := rand.New(rand.NewPCG(seed, 2))
+		replicas := make([]*ORSet[*setMember], 4)
+		for i := range replicas {
+			replicas[i] = NewORSet[*setMember](fmt.Sprint("n", i))
+		}
+		inbox := make([][]ORSetState[*setMember], len(replicas))
+
+		for range 300 {
+			i := rng.IntN(len(replicas))
+			r := replicas[i]
+			m := &setMember{ID: fmt.Sprint(rng.IntN(10)), Note: fmt.Sprint(i, rng.IntN(100))}
+			switch rng.IntN(5) {
+			case 0, 1:
+				r.Remove(m)
+			case 2:
+				// gossip the delta, possibly lost or duplicated
+				d, ok := r.Delta()
+				if !ok {
+					continue
+				}
+				for j := range inbox {
+					if j != i && rng.IntN(4) != 0 {
+						inbox[j] = append(inbox[j], d)
+						if rng.IntN(4) == 0 {
+							inbox[j] = append(inbox[j], d)
+						}
+					}
+				}
+			case 3:
+				// deliver in any order
+				j := rng.IntN(len(replicas))
+				rng.Shuffle(len(inbox[j]), func(a, b int) {
+					inbox[j][a], inbox[j][b] = inbox[j][b], inbox[j][a]
+				})
+				for _, d := range inbox[j] {
+					replicas[j].MergeState(d)
+				}
+				inbox[j] = nil
+			default:
+				r.Add(m)
+			}
+		}
+
+		// full state exchange repairs lost deltas
+		for range 2 {
+			for _, i := range rng.Perm(len(replicas)) {
+				for _, j := range rng.Perm(len(replicas)) {
+					replicas[i].Merge(replicas[j])
+				}
+			}
+		}
+		want := members(replicas[0])
+		for _, r := range replicas[1:] {
+			if !slices.Equal(members(r), want) {
+				t.Logf("%v != %v", members(r), want)
+				return false
+			}
+			if len(r.State().Dots) != 0 {
+				t.Log("causal context not compacted")
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(prop, &quick.Config{MaxCount: 100}); err != nil {
+		t.Fatal(err)
+	}
+}
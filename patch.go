@@ -0,0 +1,448 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ///////////////////////////
+// JSON patches
+// ///////////////////////////
+
+type PatchKind uint8
+
+const (
+	MergePatch PatchKind = iota + 1 // RFC 7396 JSON Merge Patch
+	JSONPatch                       // RFC 6902 JSON Patch
+)
+
+var (
+	ErrNotFound  = errors.New("syncmap: key not found")
+	ErrPatchTest = errors.New("syncmap: json patch test failed")
+)
+
+// Validator is implemented by values that can check themselves after a patch
+type Validator interface {
+	Validate() error
+}
+
+// Patch applies a JSON patch to the value of key under the write lock. The
+// value is encoded with encoding/json, patched, decoded into a new V and
+// validated if V implements Validator. Fields that aren't encoded to JSON
+// are not carried over. On error the stored value is unchanged
+func (c *Collection[K, V]) Patch(key K, patch []byte, kind PatchKind) (err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	old, ok := c.m[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	v, err := applyPatch(old, patch, kind)
+	if err != nil {
+		return err
+	}
+	c.store(key, v)
+	return nil
+}
+
+func applyPatch[V any](old V, patch []byte, kind PatchKind) (v V, err error) {
+	b, err := json.Marshal(old)
+	if err != nil {
+		return v, err
+	}
+	doc, err := decodeJSON(b)
+	if err != nil {
+		return v, err
+	}
+
+	switch kind {
+	case MergePatch:
+		p, err := decodeJSON(patch)
+		if err != nil {
+			return v, fmt.Errorf("syncmap: invalid merge patch: %w", err)
+		}
+		doc = mergePatch(doc, p)
+	case JSONPatch:
+		doc, err = jsonPatch(doc, patch)
+		if err != nil {
+			return v, err
+		}
+	default:
+		return v, fmt.Errorf("syncmap: unknown patch kind %d", kind)
+	}
+
+	b, err = json.Marshal(doc)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return v, err
+	}
+	if val, ok := any(v).(Validator); ok {
+		err = val.Validate()
+		if err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// GeneratePatch returns the minimal RFC 7396 merge patch turning old into new
+func GeneratePatch(old, new any) ([]byte, error) {
+	a, err := toJSONDoc(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONDoc(new)
+	if err != nil {
+		return nil, err
+	}
+
+	p, changed := mergeDiff(a, b)
+	if !changed {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(p)
+}
+
+func toJSONDoc(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
+
+// decodeJSON decodes into generic values, keeping numbers exact
+func decodeJSON(b []byte) (doc any, err error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	err = d.Decode(&doc)
+	return doc, err
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+func mergeDiff(a, b any) (patch any, changed bool) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil, false
+		}
+		return b, true
+	}
+
+	p := make(map[string]any)
+	for k, av := range am {
+		bv, ok := bm[k]
+		if !ok {
+			p[k] = nil
+			continue
+		}
+		if d, ok := mergeDiff(av, bv); ok {
+			p[k] = d
+		}
+	}
+	for k, bv := range bm {
+		if _, ok := am[k]; !ok {
+			p[k] = bv
+		}
+	}
+	return p, len(p) > 0
+}
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func jsonPatch(doc any, patch []byte) (any, error) {
+	var ops []patchOp
+	err := json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("syncmap: invalid json patch: %w", err)
+	}
+
+	for i, op := range ops {
+		doc, err = applyOp(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("syncmap: json patch op %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOp(doc any, op patchOp) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		value, err = decodeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = getPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, errors.New("can't move into own child")
+			}
+			doc, err = removePointer(doc, from)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value, err = toJSONDoc(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addPointer(doc, path, value)
+	case "remove":
+		return removePointer(doc, path)
+	case "replace":
+		_, err = getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, err = removePointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(doc, path, value)
+	case "test":
+		cur, err := getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(cur, value) {
+			return nil, ErrPatchTest
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// jsonEqual compares decoded JSON values as RFC 6902 test does, numbers by
+// their value so 2800 equals 2800.0 and 2.8e3
+func jsonEqual(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, _, errA := big.ParseFloat(a.String(), 10, 1024, big.ToNearestEven)
+		y, _, errB := big.ParseFloat(b.String(), 10, 1024, big.ToNearestEven)
+		if errA != nil || errB != nil {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("invalid json pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(tok string, n int, insert bool) (int, error) {
+	if insert && tok == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || (tok != "0" && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	if i > n || (!insert && i == n) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func getPointer(doc any, path []string) (any, error) {
+	for _, tok := range path {
+		switch n := doc.(type) {
+		case map[string]any:
+			v, ok := n[tok]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", tok)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(tok, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, fmt.Errorf("can't index %T with %q", doc, tok)
+		}
+	}
+	return doc, nil
+}
+
+// updatePointer calls fn with the parent of the last token and stores the
+// returned container back into the document
+func updatePointer(doc any, path []string, fn func(parent any, tok string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	switch n := doc.(type) {
+	case map[string]any:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", path[0])
+		}
+		child, err := updatePointer(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := updatePointer(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("can't index %T with %q", doc, path[0])
+}
+
+func addPointer(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updatePointer(doc, path, func(parent any, tok string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			n[tok] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(tok, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		return nil, fmt.Errorf("can't add %q to %T", tok, parent)
+	})
+}
+
+func removePointer(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("can't remove the whole document")
+	}
+	return updatePointer(doc, path, func(parent any, tok string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			if _, ok := n[tok]; !ok {
+				return nil, fmt.Errorf("member %q not found", tok)
+			}
+			delete(n, tok)
+			return n, nil
+		case []any:
+			i, err := arrayIndex(tok, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("can't remove %q from %T", tok, parent)
+	})
+}
@@ -0,0 +1,133 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func patchNetworks(t *testing.T) *Collection[string, *ZTNetwork] {
+	t.Helper()
+
+	var net ZTNetwork
+	err := json.Unmarshal([]byte(jsonData), &net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := NewCollection[string, *ZTNetwork]()
+	col.Add(net.NWID, &net)
+	return col
+}
+
+func TestPatchMerge(t *testing.T) {
+	col := patchNetworks(t)
+	old, _ := col.Get("95987162f3023a29")
+
+	err := col.Patch("95987162f3023a29", []byte(`{"mtu":1400,"name":null,"v6AssignMode":{"zt":true}}`), MergePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, _ := col.Get("95987162f3023a29")
+	if n == old {
+		t.Fatal("stored pointer was modified in place")
+	}
+	if n.MTU != 1400 || n.Name != "" || !n.V6AssignMode.ZT || n.NWID != old.NWID {
+		t.Fatalf("unexpected result %+v", n)
+	}
+	if old.MTU != 2800 {
+		t.Fatal("old value changed")
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	col := patchNetworks(t)
+
+	patch := `[
+		{"op":"test","path":"/mtu","value":2800},
+		{"op":"test","path":"/mtu","value":2800.0},
+		{"op":"test","path":"/mtu","value":2.8e3},
+		{"op":"replace","path":"/mtu","value":1400},
+		{"op":"add","path":"/routes","value":[]},
+		{"op":"add","path":"/routes/-","value":{"target":"10.0.0.0/24"}},
+		{"op":"copy","from":"/name","path":"/remoteTraceTarget"},
+		{"op":"add","path":"/rules/0","value":{"type":"ACTION_DROP"}},
+		{"op":"remove","path":"/rules/1"}
+	]`
+	err := col.Patch("95987162f3023a29", []byte(patch), JSONPatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, _ := col.Get("95987162f3023a29")
+	if n.MTU != 1400 || len(n.Routes) != 1 || n.Routes[0].Target != "10.0.0.0/24" {
+		t.Fatalf("unexpected result %+v", n)
+	}
+	if n.RemoteTraceTarget != "test network" {
+		t.Fatalf("copy failed: %q", n.RemoteTraceTarget)
+	}
+	if len(n.Rules) != 1 || n.Rules[0].Type != "ACTION_DROP" {
+		t.Fatalf("rules %+v", n.Rules)
+	}
+}
+
+func TestPatchFailureKeepsValue(t *testing.T) {
+	col := patchNetworks(t)
+	old, _ := col.Get("95987162f3023a29")
+
+	patch := `[{"op":"replace","path":"/mtu","value":1400},{"op":"test","path":"/name","value":"other"}]`
+	err := col.Patch("95987162f3023a29", []byte(patch), JSONPatch)
+	if !errors.Is(err, ErrPatchTest) {
+		t.Fatalf("got %v, want ErrPatchTest", err)
+	}
+	if n, _ := col.Get("95987162f3023a29"); n != old {
+		t.Fatal("value replaced after failed patch")
+	}
+
+	for _, v := range []string{`2800.5`, `"2800"`, `2.8e2`} {
+		err = col.Patch("95987162f3023a29", []byte(`[{"op":"test","path":"/mtu","value":`+v+`}]`), JSONPatch)
+		if !errors.Is(err, ErrPatchTest) {
+			t.Fatalf("test against %s: got %v, want ErrPatchTest", v, err)
+		}
+	}
+
+	err = col.Patch("missing", []byte(`{}`), MergePatch)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	err = col.Patch("95987162f3023a29", []byte(`[{"op":"remove","path":"/rules/5"}]`), JSONPatch)
+	if err == nil {
+		t.Fatal("expected out of range error")
+	}
+}
+
+func TestGeneratePatch(t *testing.T) {
+	old := &ZTNetwork{NWID: "a", Name: "net", MTU: 2800, V6AssignMode: V6AssignMode{ZT: true, SixPlane: true}}
+	new := &ZTNetwork{NWID: "a", MTU: 1400, V6AssignMode: V6AssignMode{ZT: true}}
+
+	p, err := GeneratePatch(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"mtu":1400,"name":null,"v6AssignMode":{"6plane":null}}`
+	if string(p) != want {
+		t.Fatalf("got %s, want %s", p, want)
+	}
+
+	col := NewCollection[string, *ZTNetwork]()
+	col.Add("a", old)
+	err = col.Patch("a", p, MergePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := col.Get("a")
+	if !DigestEqual(got, new) {
+		t.Fatalf("patched %+v, want %+v", got, new)
+	}
+
+	p, _ = GeneratePatch(new, new)
+	if string(p) != "{}" {
+		t.Fatalf("got %s for equal values", p)
+	}
+}
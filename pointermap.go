@@ -3,7 +3,6 @@ package syncmap
 import (
 	"iter"
 	"strconv"
-	"sync"
 )
 
 /////////////////////////////
@@ -16,7 +15,7 @@ type PointerType interface {
 }
 
 type PointerMap[K PointerType] struct {
-	mtx *sync.RWMutex
+	mtx *rwMutex
 	m   map[K]struct{}
 }
 
@@ -27,7 +26,7 @@ func NewPointerMap[K PointerType]() *PointerMap[K] {
 }
 
 func newPointerMap[K PointerType](p *PointerMap[K]) *PointerMap[K] {
-	p.mtx = &sync.RWMutex{}
+	p.mtx = newRWMutex()
 	p.m = make(map[K]struct{})
 
 	return p
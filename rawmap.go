@@ -0,0 +1,245 @@
+package syncmap
+
+import (
+	"bytes"
+	"container/list"
+	"iter"
+	"strconv"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ///////////////////////////
+// Raw Collection
+// ///////////////////////////
+
+// RawCollection keeps values as canonical CBOR and decodes them on Get.
+// Large, rarely read values cost only their encoded size
+type RawCollection[K MapKey, V any] struct {
+	mtx   *rwMutex
+	m     map[K]cbor.RawMessage
+	cache *decodeCache[K, V] // nil if disabled
+}
+
+// NewRawCollection creates new empty m: map[K]cbor.RawMessage. cacheSize
+// decoded values are kept in an LRU cache, 0 disables the cache
+func NewRawCollection[K MapKey, V any](cacheSize int) *RawCollection[K, V] {
+	var c RawCollection[K, V]
+	return newRawCollection(&c, cacheSize)
+}
+
+func newRawCollection[K MapKey, V any](c *RawCollection[K, V], cacheSize int) *RawCollection[K, V] {
+	c.mtx = newRWMutex()
+	c.m = make(map[K]cbor.RawMessage)
+	if cacheSize > 0 {
+		c.cache = newDecodeCache[K, V](cacheSize)
+	}
+	return c
+}
+
+// Exists check if key exists
+func (c *RawCollection[K, _]) Exists(key K) (ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	_, ok = c.m[key]
+	return ok
+}
+
+// Get decodes val with key. Cached pointer values are shared between
+// callers and must not be modified
+func (c *RawCollection[K, V]) Get(key K) (val V, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	raw, ok := c.m[key]
+	if !ok {
+		return val, false
+	}
+	if c.cache != nil {
+		if val, ok = c.cache.get(key); ok {
+			return val, true
+		}
+	}
+
+	// can't fail, raw was encoded from or validated against V
+	if cbor.Unmarshal(raw, &val) != nil {
+		return val, false
+	}
+	if c.cache != nil {
+		c.cache.put(key, val)
+	}
+	return val, true
+}
+
+// GetRaw returns the encoded value without copying, it must not be modified
+func (c *RawCollection[K, _]) GetRaw(key K) (raw cbor.RawMessage, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	raw, ok = c.m[key]
+	return raw, ok
+}
+
+// Add encodes key / val to map, returns true if the key is new or the
+// encoding changed
+func (c *RawCollection[K, V]) Add(k K, v V) (changed bool, err error) {
+	raw, err := canonicalEnc.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.store(k, raw), nil
+}
+
+// AddRaw adds an encoded value, raw is copied and must decode into V.
+// Non-canonical encodings are stored as they are
+func (c *RawCollection[K, V]) AddRaw(k K, raw []byte) (changed bool, err error) {
+	var v V
+	err = cbor.Unmarshal(raw, &v)
+	if err != nil {
+		return false, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.store(k, bytes.Clone(raw)), nil
+}
+
+// store sets key / raw and invalidates the cache, c.mtx must be write locked
+func (c *RawCollection[K, _]) store(k K, raw cbor.RawMessage) (changed bool) {
+	old, ok := c.m[k]
+	if ok && bytes.Equal(old, raw) {
+		return false
+	}
+	c.m[k] = raw
+	if c.cache != nil {
+		c.cache.remove(k)
+	}
+	return true
+}
+
+// Remove key from map
+func (c *RawCollection[K, _]) Remove(key K) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.m, key)
+	if c.cache != nil {
+		c.cache.remove(key)
+	}
+}
+
+// Len of map
+func (c *RawCollection[_, _]) Len() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return len(c.m)
+}
+
+func (c *RawCollection[_, _]) LenStr() string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return strconv.Itoa(len(c.m))
+}
+
+// Iter decodes and iterates over all elements of K, bypassing the cache
+func (c *RawCollection[K, V]) Iter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mtx.RLock()
+		defer c.mtx.RUnlock()
+
+		for k, raw := range c.m {
+			var v V
+			if cbor.Unmarshal(raw, &v) != nil {
+				continue
+			}
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// IterRaw iterates over all encoded elements of K without decoding
+func (c *RawCollection[K, _]) IterRaw() iter.Seq2[K, cbor.RawMessage] {
+	return func(yield func(K, cbor.RawMessage) bool) {
+		c.mtx.RLock()
+		defer c.mtx.RUnlock()
+
+		for k, raw := range c.m {
+			if !yield(k, raw) {
+				return
+			}
+		}
+	}
+}
+
+// decodeCache is a small LRU of decoded values. It has its own lock as
+// it's updated by readers
+type decodeCache[K MapKey, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // front is most recent
+	items map[K]*list.Element
+}
+
+type cacheEntry[K MapKey, V any] struct {
+	key K
+	val V
+}
+
+func newDecodeCache[K MapKey, V any](size int) *decodeCache[K, V] {
+	return &decodeCache[K, V]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[K]*list.Element, size),
+	}
+}
+
+func (c *decodeCache[K, V]) get(key K) (val V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return val, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(cacheEntry[K, V]).val, true
+}
+
+func (c *decodeCache[K, V]) put(key K, val V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value = cacheEntry[K, V]{key: key, val: val}
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(cacheEntry[K, V]{key: key, val: val})
+
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(cacheEntry[K, V]).key)
+	}
+}
+
+func (c *decodeCache[K, _]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
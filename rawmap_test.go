@@ -0,0 +1,134 @@
+package syncmap
+
+import (
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func testNetwork(t testing.TB) *ZTNetwork {
+	t.Helper()
+
+	var net ZTNetwork
+	err := json.Unmarshal([]byte(jsonData), &net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &net
+}
+
+func TestRawCollection(t *testing.T) {
+	net := testNetwork(t)
+	col := NewRawCollection[string, *ZTNetwork](2)
+
+	changed, err := col.Add(net.NWID, net)
+	if err != nil || !changed {
+		t.Fatalf("Add: changed=%v err=%v", changed, err)
+	}
+	changed, _ = col.Add(net.NWID, net)
+	if changed {
+		t.Fatal("same value reported as changed")
+	}
+
+	got, ok := col.Get(net.NWID)
+	if !ok || got.Name != net.Name || got.MTU != net.MTU || len(got.Rules) != 1 {
+		t.Fatalf("Get: %+v", got)
+	}
+	if cached, _ := col.Get(net.NWID); cached != got {
+		t.Fatal("second Get not served from cache")
+	}
+
+	raw, ok := col.GetRaw(net.NWID)
+	if !ok {
+		t.Fatal("GetRaw failed")
+	}
+	want, _ := canonicalEnc.Marshal(net)
+	if string(raw) != string(want) {
+		t.Fatal("raw is not the canonical encoding")
+	}
+
+	// forward to another collection
+	other := NewRawCollection[string, *ZTNetwork](0)
+	_, err = other.AddRaw(net.NWID, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.AddRaw("bad", []byte{0xff})
+	if err == nil {
+		t.Fatal("AddRaw accepted invalid CBOR")
+	}
+
+	// updates invalidate the cache
+	net.MTU = 1400
+	changed, _ = col.Add(net.NWID, net)
+	if !changed {
+		t.Fatal("update not reported")
+	}
+	if got, _ := col.Get(net.NWID); got.MTU != 1400 {
+		t.Fatalf("stale cached value, MTU %d", got.MTU)
+	}
+
+	col.Remove(net.NWID)
+	if col.Exists(net.NWID) || col.cache.ll.Len() != 0 {
+		t.Fatal("Remove left entry or cache behind")
+	}
+}
+
+func TestDecodeCacheEvicts(t *testing.T) {
+	col := NewRawCollection[string, *ZTPeerID](2)
+	for i := range 5 {
+		k := strconv.Itoa(i)
+		col.Add(k, &ZTPeerID{Address: k})
+		col.Get(k)
+	}
+	if col.cache.ll.Len() != 2 {
+		t.Fatalf("cache holds %d entries, want 2", col.cache.ll.Len())
+	}
+	if _, ok := col.cache.get("4"); !ok {
+		t.Fatal("most recent entry evicted")
+	}
+}
+
+func BenchmarkRawCollectionMemory(b *testing.B) {
+	net := testNetwork(b)
+	net.Routes = []ZTRoutes{{Target: "10.0.0.0/24"}, {Target: "10.0.1.0/24", Via: "10.0.0.1"}}
+	net.IPAssignmentPools = []IPAssignmentPool{{IPRangeStart: "10.0.0.1", IPRangeEnd: "10.0.0.254"}}
+
+	const n = 5000
+	decoded := func(i int) *ZTNetwork {
+		var v ZTNetwork
+		raw, _ := cbor.Marshal(net)
+		cbor.Unmarshal(raw, &v)
+		v.NWID = strconv.Itoa(i)
+		return &v
+	}
+
+	b.Run("collection", func(b *testing.B) {
+		var col *Collection[string, *ZTNetwork]
+		before := heapInUse()
+		for range b.N {
+			col = NewCollection[string, *ZTNetwork]()
+			for i := range n {
+				col.Add(strconv.Itoa(i), decoded(i))
+			}
+		}
+		b.ReportMetric(float64(heapInUse()-before), "heap-B")
+		runtime.KeepAlive(col)
+	})
+
+	b.Run("raw", func(b *testing.B) {
+		var col *RawCollection[string, *ZTNetwork]
+		before := heapInUse()
+		for range b.N {
+			col = NewRawCollection[string, *ZTNetwork](16)
+			for i := range n {
+				col.Add(strconv.Itoa(i), decoded(i))
+			}
+		}
+		b.ReportMetric(float64(heapInUse()-before), "heap-B")
+		runtime.KeepAlive(col)
+	})
+}
@@ -0,0 +1,94 @@
+package syncmap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ///////////////////////////
+// Replicas
+// ///////////////////////////
+// A replica copies the revisions of its source exactly, so a client can
+// resume against either.
+
+// ErrRevGap is returned by Apply when an event doesn't follow the current revision
+var ErrRevGap = errors.New("syncmap: revision gap")
+
+// Entry is a key, its value and the revision of its last change
+type Entry[K MapKey, V any] struct {
+	Key   K      `json:"key" cbor:"key"`
+	Rev   uint64 `json:"rev" cbor:"rev"`
+	Value V      `json:"value" cbor:"value"`
+}
+
+// SubscribeEntries copies the collection with the entry revisions and
+// subscribes to the changes after it in one step, rev and epoch are the
+// revision and epoch of the copy
+func (c *Collection[K, V]) SubscribeEntries(buf int) (entries []Entry[K, V], rev, epoch uint64, sub *Subscription[K, V]) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entries = make([]Entry[K, V], 0, len(c.m))
+	for k, v := range c.m {
+		entries = append(entries, Entry[K, V]{Key: k, Rev: c.revs[k], Value: v})
+	}
+	return entries, c.rev, c.epoch, c.events.subscribe(buf)
+}
+
+// Restore replaces the contents with entries taken at rev, eg by
+// SubscribeEntries on another collection. The change log is cleared, the
+// epoch changes and subscribers get an OpReset
+func (c *Collection[K, V]) Restore(entries []Entry[K, V], rev uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.m = make(map[K]V, len(entries))
+	clear(c.revs)
+	for _, e := range entries {
+		c.m[e.Key] = e.Value
+		c.revs[e.Key] = e.Rev
+	}
+	if c.digests != nil {
+		c.resetDigests()
+	}
+	c.rev = rev
+	c.epoch = newEpoch()
+	if c.log != nil {
+		c.log = newChangeLog[K, V](len(c.log.buf))
+	}
+	c.wait.notifyAll()
+	c.publish(Event[K, V]{Op: OpReset, Rev: rev})
+}
+
+// Apply replays an event of another collection, its Rev must be one more
+// than Rev(). OpReset can't be applied, use Restore
+func (c *Collection[K, V]) Apply(e Event[K, V]) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e.Rev != c.rev+1 {
+		return fmt.Errorf("%w: rev %d after %d", ErrRevGap, e.Rev, c.rev)
+	}
+
+	old := c.m[e.Key]
+	switch e.Op {
+	case OpAdd, OpUpdate, OpDelete, OpUndelete:
+		c.m[e.Key] = e.Value
+		c.revs[e.Key] = e.Rev
+		if c.digests != nil {
+			c.storeDigest(e.Key, e.Value)
+		}
+	case OpRemove:
+		delete(c.m, e.Key)
+		delete(c.revs, e.Key)
+		c.dropDigest(e.Key)
+	default:
+		return fmt.Errorf("syncmap: can't apply %s", e.Op)
+	}
+
+	c.rev = e.Rev
+	c.wait.notify(e.Key)
+	e.Old = old
+	c.publish(e)
+	return nil
+}
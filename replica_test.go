@@ -0,0 +1,58 @@
+package syncmap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyRestore(t *testing.T) {
+	src := NewCollection[string, *ZTPeerID]()
+	src.Add("a", &ZTPeerID{Address: "a"})
+	src.Add("b", &ZTPeerID{Address: "b"})
+
+	entries, rev, srcEpoch, sub := src.SubscribeEntries(10)
+	defer sub.Close()
+	if srcEpoch != src.Epoch() {
+		t.Fatal("SubscribeEntries returned another epoch")
+	}
+
+	dst := NewCollection[string, *ZTPeerID](WithChangeLog(10), WithDigest())
+	dst.Add("stale", &ZTPeerID{})
+	epoch := dst.Epoch()
+	dst.Restore(entries, rev)
+	if dst.Epoch() == epoch || dst.Epoch() == srcEpoch {
+		t.Fatal("epoch not renewed by Restore")
+	}
+	if dst.Len() != 2 || dst.Exists("stale") || dst.Rev() != 2 {
+		t.Fatalf("restored len %d rev %d", dst.Len(), dst.Rev())
+	}
+	if r, _ := dst.Revision("b"); r != 2 {
+		t.Fatalf("rev of b %d, want 2", r)
+	}
+	if _, ok := dst.Digest("a"); !ok {
+		t.Fatal("digest not restored")
+	}
+
+	src.Remove("a")
+	src.Add("c", &ZTPeerID{Address: "c"})
+	for range 2 {
+		if err := dst.Apply(<-sub.C); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dst.Exists("a") || !dst.Exists("c") || dst.Rev() != src.Rev() {
+		t.Fatal("events not applied")
+	}
+
+	err := dst.Apply(Event[string, *ZTPeerID]{Op: OpAdd, Key: "d", Rev: dst.Rev() + 2})
+	if !errors.Is(err, ErrRevGap) {
+		t.Fatalf("got %v, want ErrRevGap", err)
+	}
+
+	// the log restarts at the restore
+	missed, resub, ok := dst.SubscribeSince(1, 10)
+	if !ok || len(missed) != 3 || missed[0].Op != OpReset {
+		t.Fatalf("missed %+v ok %v", missed, ok)
+	}
+	resub.Close()
+}
@@ -0,0 +1,212 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// FollowerOptions configures a Follower
+type FollowerOptions struct {
+	// MinBackoff is the first reconnect delay, 100ms if 0
+	MinBackoff time.Duration
+	// MaxBackoff caps the reconnect delay, 30s if 0
+	MaxBackoff time.Duration
+	// MaxFrame caps the encoded size of a frame, 64 MiB if 0
+	MaxFrame int
+	// OnError is called when the connection fails
+	OnError func(error)
+}
+
+// FollowerStats describes the replication state of a Follower
+type FollowerStats struct {
+	Connected  bool
+	Rev        uint64 // revision applied
+	Epoch      uint64 // leader epoch Rev belongs to, 0 before the first sync
+	Snapshots  int    // snapshots received
+	Reconnects uint64
+	LastError  error
+}
+
+// Follower applies the changes streamed by a Leader to a local
+// collection. The collection must not be modified by anything else, its
+// revisions have to match the leader's
+type Follower[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c    *syncmap.Collection[K, V]
+	opts FollowerOptions
+
+	mtx   sync.Mutex
+	stats FollowerStats
+	epoch uint64 // leader epoch the collection is in sync with
+}
+
+// NewFollower creates a follower replicating into c
+func NewFollower[K syncmap.MapKey, V syncmap.MapValue](c *syncmap.Collection[K, V], opts FollowerOptions) *Follower[K, V] {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.MaxFrame <= 0 {
+		opts.MaxFrame = defaultMaxFrame
+	}
+	return &Follower[K, V]{c: c, opts: opts}
+}
+
+// Stats returns the replication state
+func (f *Follower[_, _]) Stats() FollowerStats {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	st := f.stats
+	st.Rev = f.c.Rev()
+	st.Epoch = f.epoch
+	return st
+}
+
+// Run connects with dial and replicates until ctx is done, reconnecting
+// with backoff. See DialTCP
+func (f *Follower[K, V]) Run(ctx context.Context, dial func(context.Context) (net.Conn, error)) error {
+	backoff := f.opts.MinBackoff
+	for {
+		applied, err := f.run(ctx, dial)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		f.fail(err)
+		if applied {
+			backoff = f.opts.MinBackoff
+		}
+
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, f.opts.MaxBackoff)
+
+		f.mtx.Lock()
+		f.stats.Reconnects++
+		f.mtx.Unlock()
+	}
+}
+
+func (f *Follower[K, V]) run(ctx context.Context, dial func(context.Context) (net.Conn, error)) (applied bool, err error) {
+	conn, err := dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	return f.sync(ctx, conn)
+}
+
+// Sync replicates over conn until ctx is done or the connection fails.
+// conn is closed on return
+func (f *Follower[K, V]) Sync(ctx context.Context, conn net.Conn) error {
+	_, err := f.sync(ctx, conn)
+	return err
+}
+
+func (f *Follower[K, V]) sync(ctx context.Context, conn net.Conn) (applied bool, err error) {
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	f.mtx.Lock()
+	epoch := f.epoch
+	f.mtx.Unlock()
+
+	w := bufio.NewWriter(conn)
+	err = writeFrame(w, &frame[K, V]{Type: frameHello, Rev: f.c.Rev(), Epoch: epoch}, f.opts.MaxFrame)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	f.mtx.Lock()
+	f.stats.Connected = true
+	f.mtx.Unlock()
+
+	r := bufio.NewReader(conn)
+	var snap []syncmap.Entry[K, V] // chunks of an incomplete snapshot
+	for {
+		var fr frame[K, V]
+		err = readFrame(r, &fr, f.opts.MaxFrame)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return applied, err
+		}
+
+		if snap != nil && fr.Type != frameSnapshot {
+			return applied, fmt.Errorf("replication: frame type %d inside a snapshot", fr.Type)
+		}
+
+		switch fr.Type {
+		case frameHello:
+			// resuming within the leader epoch
+			f.mtx.Lock()
+			f.epoch = fr.Epoch
+			f.mtx.Unlock()
+			continue
+		case frameSnapshot:
+			snap = append(snap, fr.Entries...)
+			if fr.More {
+				continue
+			}
+			f.c.Restore(snap, fr.Rev)
+			snap = nil
+			f.mtx.Lock()
+			f.epoch = fr.Epoch
+			f.stats.Snapshots++
+			f.mtx.Unlock()
+		case frameChange:
+			err = f.c.Apply(syncmap.Event[K, V]{Op: fr.Op, Key: fr.Key, Value: fr.Value, Rev: fr.Rev})
+			if err != nil {
+				// reconnecting resumes from our revision
+				return applied, err
+			}
+		default:
+			return applied, fmt.Errorf("replication: unexpected frame type %d from leader", fr.Type)
+		}
+		applied = true
+
+		// acknowledge once the received frames are applied
+		if r.Buffered() > 0 {
+			continue
+		}
+		err = writeFrame(w, &frame[K, V]{Type: frameAck, Rev: fr.Rev}, f.opts.MaxFrame)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return applied, err
+		}
+	}
+}
+
+func (f *Follower[_, _]) fail(err error) {
+	if err == nil {
+		err = errors.New("replication: connection closed")
+	}
+
+	f.mtx.Lock()
+	f.stats.Connected = false
+	f.stats.LastError = err
+	f.mtx.Unlock()
+
+	if f.opts.OnError != nil {
+		f.opts.OnError(err)
+	}
+}
@@ -0,0 +1,294 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+// LeaderOptions configures a Leader
+type LeaderOptions struct {
+	// Buffer is the number of changes a follower may fall behind before it
+	// gets a new snapshot, 1024 if 0
+	Buffer int
+	// MaxFrame caps the encoded size of a frame, 64 MiB if 0
+	MaxFrame int
+	// SnapshotChunk is the number of entries per snapshot frame, 1024 if 0.
+	// Chunks that don't fit MaxFrame are split further
+	SnapshotChunk int
+	// OnError is called when a follower connection fails
+	OnError func(addr string, err error)
+}
+
+// FollowerStatus describes a connected follower
+type FollowerStatus struct {
+	Addr      string
+	Connected time.Time
+	Sent      uint64 // last revision sent
+	Acked     uint64 // last revision applied by the follower
+	Snapshots int    // snapshots sent
+}
+
+// Leader streams the changes of a collection to followers. Give the
+// collection a change log, see syncmap.WithChangeLog, so reconnecting
+// followers don't need a full snapshot
+type Leader[K syncmap.MapKey, V syncmap.MapValue] struct {
+	c    *syncmap.Collection[K, V]
+	opts LeaderOptions
+
+	mtx       sync.Mutex
+	followers map[*FollowerStatus]struct{}
+}
+
+// NewLeader creates a leader for c
+func NewLeader[K syncmap.MapKey, V syncmap.MapValue](c *syncmap.Collection[K, V], opts LeaderOptions) *Leader[K, V] {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1024
+	}
+	if opts.MaxFrame <= 0 {
+		opts.MaxFrame = defaultMaxFrame
+	}
+	if opts.SnapshotChunk <= 0 {
+		opts.SnapshotChunk = defaultSnapshotChunk
+	}
+	return &Leader[K, V]{
+		c:         c,
+		opts:      opts,
+		followers: make(map[*FollowerStatus]struct{}),
+	}
+}
+
+// Followers returns the status of the connected followers
+func (l *Leader[_, _]) Followers() []FollowerStatus {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	st := make([]FollowerStatus, 0, len(l.followers))
+	for f := range l.followers {
+		st = append(st, *f)
+	}
+	return st
+}
+
+// Serve accepts followers on ln until ctx is done or ln fails, then waits
+// for the follower connections to end. ln is closed on return
+func (l *Leader[K, V]) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+	})
+	defer stop()
+	defer ln.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := l.ServeConn(ctx, conn)
+			if err != nil && ctx.Err() == nil && l.opts.OnError != nil {
+				l.opts.OnError(conn.RemoteAddr().String(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn streams to one follower until ctx is done or the connection
+// fails. conn is closed on return
+func (l *Leader[K, V]) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	var hello frame[K, V]
+	err := readFrame(r, &hello, l.opts.MaxFrame)
+	if err != nil {
+		return err
+	}
+	if hello.Type != frameHello {
+		return fmt.Errorf("replication: expected hello, got frame type %d", hello.Type)
+	}
+
+	st := &FollowerStatus{Addr: conn.RemoteAddr().String(), Connected: time.Now(), Acked: hello.Rev}
+	l.mtx.Lock()
+	l.followers[st] = struct{}{}
+	l.mtx.Unlock()
+	defer func() {
+		l.mtx.Lock()
+		delete(l.followers, st)
+		l.mtx.Unlock()
+	}()
+
+	acks := make(chan error, 1)
+	go func() {
+		acks <- l.readAcks(r, st)
+		conn.Close()
+	}()
+
+	s := &leaderStream[K, V]{l: l, st: st, w: bufio.NewWriter(conn)}
+	defer s.close()
+
+	// revisions only match within the same epoch, a follower without any
+	// has nothing to conflict with
+	epoch := l.c.Epoch()
+	var (
+		missed []syncmap.Event[K, V]
+		sub    *syncmap.Subscription[K, V]
+		ok     bool
+	)
+	if hello.Epoch == epoch || hello.Rev == 0 {
+		missed, sub, ok = l.c.SubscribeSince(hello.Rev, l.opts.Buffer)
+		if ok && l.c.Epoch() != epoch {
+			// restored in between, the log is of another history
+			sub.Close()
+			ok = false
+		}
+	}
+	if ok {
+		s.sub = sub
+		s.write(&frame[K, V]{Type: frameHello, Rev: hello.Rev, Epoch: epoch})
+		for _, e := range missed {
+			s.change(e)
+			if e.Op == syncmap.OpReset {
+				// the snapshot includes the rest
+				break
+			}
+		}
+	} else {
+		s.snapshot()
+	}
+
+	for {
+		if s.err == nil {
+			s.err = s.w.Flush()
+		}
+		if s.err != nil {
+			return s.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-acks:
+			return err
+		case e, ok := <-s.sub.C:
+			if !ok {
+				// too far behind
+				s.snapshot()
+				continue
+			}
+			s.change(e)
+			// batch what's queued into one flush
+			for len(s.sub.C) > 0 && s.err == nil {
+				if e, ok := <-s.sub.C; ok {
+					s.change(e)
+				}
+			}
+		}
+	}
+}
+
+func (l *Leader[K, V]) readAcks(r *bufio.Reader, st *FollowerStatus) error {
+	for {
+		var f frame[K, V]
+		err := readFrame(r, &f, l.opts.MaxFrame)
+		if err != nil {
+			return err
+		}
+		if f.Type != frameAck {
+			return errors.New("replication: unexpected frame from follower")
+		}
+
+		l.mtx.Lock()
+		st.Acked = f.Rev
+		l.mtx.Unlock()
+	}
+}
+
+type leaderStream[K syncmap.MapKey, V syncmap.MapValue] struct {
+	l   *Leader[K, V]
+	st  *FollowerStatus
+	w   *bufio.Writer
+	sub *syncmap.Subscription[K, V]
+	err error
+}
+
+func (s *leaderStream[K, V]) close() {
+	if s.sub != nil {
+		s.sub.Close()
+	}
+}
+
+func (s *leaderStream[K, V]) write(f *frame[K, V]) {
+	if s.err != nil {
+		return
+	}
+	s.err = writeFrame(s.w, f, s.l.opts.MaxFrame)
+	if s.err != nil || f.More {
+		return
+	}
+
+	s.l.mtx.Lock()
+	s.st.Sent = f.Rev
+	if f.Type == frameSnapshot {
+		s.st.Snapshots++
+	}
+	s.l.mtx.Unlock()
+}
+
+// snapshot sends the whole collection and subscribes to the changes after it
+func (s *leaderStream[K, V]) snapshot() {
+	s.close()
+
+	entries, rev, epoch, sub := s.l.c.SubscribeEntries(s.l.opts.Buffer)
+	s.sub = sub
+
+	chunk := s.l.opts.SnapshotChunk
+	for len(entries) > chunk {
+		s.writeSnapshot(entries[:chunk], rev, epoch, true)
+		entries = entries[chunk:]
+	}
+	s.writeSnapshot(entries, rev, epoch, false)
+}
+
+// writeSnapshot sends entries in one frame, halving them until the frames
+// fit MaxFrame
+func (s *leaderStream[K, V]) writeSnapshot(entries []syncmap.Entry[K, V], rev, epoch uint64, more bool) {
+	if s.err != nil {
+		return
+	}
+	s.write(&frame[K, V]{Type: frameSnapshot, Rev: rev, Epoch: epoch, Entries: entries, More: more})
+	if errors.Is(s.err, ErrFrameTooLarge) && len(entries) > 1 {
+		// nothing was written
+		s.err = nil
+		half := len(entries) / 2
+		s.writeSnapshot(entries[:half], rev, epoch, true)
+		s.writeSnapshot(entries[half:], rev, epoch, more)
+	}
+}
+
+func (s *leaderStream[K, V]) change(e syncmap.Event[K, V]) {
+	if e.Op == syncmap.OpReset {
+		// whole map replaced
+		s.snapshot()
+		return
+	}
+	s.write(&frame[K, V]{Type: frameChange, Rev: e.Rev, Op: e.Op, Key: e.Key, Value: e.Value})
+}
@@ -0,0 +1,106 @@
+// Package replication keeps hot standby copies of a syncmap.Collection.
+//
+// A follower connects to the leader and sends its revision and the epoch
+// of the leader history it belongs to, see syncmap.Collection.Epoch. The
+// leader replies with the changes it missed from the change log, or a
+// snapshot if the follower is too far behind or its epoch differs, eg after
+// the leader restarted, then streams every change. The follower applies
+// them in order and acknowledges the applied revision. Snapshots are sent
+// in chunks of entries.
+//
+// Each frame is a 4 byte big endian length followed by a CBOR encoded frame.
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkpowell/syncmap"
+)
+
+// ErrFrameTooLarge is returned when a frame exceeds MaxFrame
+var ErrFrameTooLarge = errors.New("replication: frame too large")
+
+const (
+	defaultMaxFrame      = 64 << 20
+	defaultSnapshotChunk = 1024
+)
+
+type frameType uint8
+
+const (
+	frameHello    frameType = iota + 1 // Rev and Epoch of the follower, the leader replies with its Epoch when resuming
+	frameSnapshot                      // Entries taken at Rev in Epoch, More if another chunk follows
+	frameChange                        // one change, Rev is the revision after it
+	frameAck                           // follower to leader, Rev was applied
+)
+
+type frame[K syncmap.MapKey, V any] struct {
+	Type    frameType             `cbor:"1,keyasint"`
+	Rev     uint64                `cbor:"2,keyasint,omitempty"`
+	Op      syncmap.EventOp       `cbor:"3,keyasint,omitempty"`
+	Key     K                     `cbor:"4,keyasint,omitempty"`
+	Value   V                     `cbor:"5,keyasint,omitempty"`
+	Entries []syncmap.Entry[K, V] `cbor:"6,keyasint,omitempty"`
+	Epoch   uint64                `cbor:"7,keyasint,omitempty"`
+	More    bool                  `cbor:"8,keyasint,omitempty"`
+}
+
+func writeFrame[K syncmap.MapKey, V any](w io.Writer, f *frame[K, V], limit int) error {
+	b, err := cbor.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(b) > limit {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, len(b))
+	}
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(b)))
+	_, err = w.Write(hdr[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func readFrame[K syncmap.MapKey, V any](r io.Reader, f *frame[K, V], limit int) error {
+	var hdr [4]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if uint64(n) > uint64(limit) {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return err
+	}
+	*f = frame[K, V]{}
+	return cbor.Unmarshal(b, f)
+}
+
+// closeOnDone closes conn when ctx is done, call stop when finished with conn
+func closeOnDone(ctx context.Context, conn net.Conn) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+}
+
+// DialTCP returns a dial func for Follower.Run connecting to addr
+func DialTCP(addr string) func(context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
@@ -0,0 +1,300 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkpowell/syncmap"
+)
+
+type host struct {
+	ID      string `cbor:"id"`
+	Addr    string `cbor:"addr"`
+	Deleted bool   `cbor:"deleted"`
+}
+
+func (h *host) GetID() string { return h.ID }
+func (h *host) Del(b bool)    { h.Deleted = b }
+
+func addHosts(c *syncmap.Collection[string, *host], from, to int) {
+	for i := from; i < to; i++ {
+		k := fmt.Sprint("h", i)
+		c.Add(k, &host{ID: k, Addr: fmt.Sprint("10.0.0.", i)})
+	}
+}
+
+// eventually polls cond until it holds or a few seconds passed
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// converged compares contents and revisions of leader and follower
+func converged(leader, follower *syncmap.Collection[string, *host]) bool {
+	if leader.Rev() != follower.Rev() || leader.Len() != follower.Len() {
+		return false
+	}
+	for k, v := range leader.IterSnapshot() {
+		fv, rev, ok := follower.GetRev(k)
+		lrev, _ := leader.Revision(k)
+		if !ok || rev != lrev || !reflect.DeepEqual(v, fv) {
+			return false
+		}
+	}
+	return true
+}
+
+// pipe connects a follower to the leader over net.Pipe until the test ends
+// or stop is called
+func pipe[K syncmap.MapKey, V syncmap.MapValue](t *testing.T, l *Leader[K, V], f *Follower[K, V]) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a, b := net.Pipe()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		l.ServeConn(ctx, a)
+		done <- struct{}{}
+	}()
+	go func() {
+		f.Sync(ctx, b)
+		done <- struct{}{}
+	}()
+
+	stopped := false
+	stop = func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		cancel()
+		<-done
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func TestReplicationPipe(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host](syncmap.WithChangeLog(100))
+	addHosts(leader, 0, 5)
+
+	follower := syncmap.NewCollection[string, *host]()
+	l := NewLeader(leader, LeaderOptions{})
+	f := NewFollower(follower, FollowerOptions{})
+	pipe(t, l, f)
+
+	eventually(t, "initial sync", func() bool { return converged(leader, follower) })
+
+	addHosts(leader, 5, 8)
+	leader.Add("h0", &host{ID: "h0", Addr: "10.0.1.0"})
+	leader.Delete("h1")
+	leader.Remove("h2")
+	eventually(t, "changes not replicated", func() bool { return converged(leader, follower) })
+	if v, _ := follower.Get("h1"); !v.Deleted {
+		t.Fatal("delete not replicated")
+	}
+
+	leader.Set(map[string]*host{"x": {ID: "x"}})
+	eventually(t, "reset not replicated", func() bool { return converged(leader, follower) })
+
+	eventually(t, "not acknowledged", func() bool {
+		st := l.Followers()
+		return len(st) == 1 && st[0].Acked == leader.Rev()
+	})
+	// 5 initial changes came from the change log, the reset needs a snapshot
+	if st := f.Stats(); st.Snapshots != 1 || !st.Connected {
+		t.Fatalf("unexpected follower stats %+v", st)
+	}
+}
+
+func TestReplicationCatchUp(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host](syncmap.WithChangeLog(4))
+	follower := syncmap.NewCollection[string, *host]()
+	l := NewLeader(leader, LeaderOptions{})
+	f := NewFollower(follower, FollowerOptions{})
+
+	addHosts(leader, 0, 3)
+	stop := pipe(t, l, f)
+	eventually(t, "initial sync", func() bool { return converged(leader, follower) })
+	stop()
+
+	// within the change log
+	addHosts(leader, 3, 5)
+	stop = pipe(t, l, f)
+	eventually(t, "resume", func() bool { return converged(leader, follower) })
+	stop()
+	if n := f.Stats().Snapshots; n != 0 {
+		t.Fatalf("%d snapshots, want a resume", n)
+	}
+
+	// too far behind
+	addHosts(leader, 5, 20)
+	pipe(t, l, f)
+	eventually(t, "catch up", func() bool { return converged(leader, follower) })
+	if n := f.Stats().Snapshots; n != 1 {
+		t.Fatalf("%d snapshots, want 1", n)
+	}
+}
+
+func TestReplicationLag(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host]()
+	l := NewLeader(leader, LeaderOptions{Buffer: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := net.Pipe()
+	defer b.Close()
+	go l.ServeConn(ctx, a)
+
+	err := writeFrame(b, &frame[string, *host]{Type: frameHello}, defaultMaxFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fr frame[string, *host]
+	if err := readFrame(b, &fr, defaultMaxFrame); err != nil || fr.Type != frameSnapshot {
+		t.Fatalf("got frame %+v err %v, want snapshot", fr, err)
+	}
+
+	// the leader blocks writing to the pipe while nobody reads
+	addHosts(leader, 0, 20)
+
+	for fr.Type != frameSnapshot || fr.Rev != leader.Rev() {
+		if err := readFrame(b, &fr, defaultMaxFrame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fr.Entries) != 20 {
+		t.Fatalf("snapshot has %d entries, want 20", len(fr.Entries))
+	}
+}
+
+func TestReplicationSnapshotChunks(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host]()
+	addHosts(leader, 0, 100)
+	follower := syncmap.NewCollection[string, *host]()
+	follower.Add("stale", &host{ID: "stale"})
+
+	// 100 entries don't fit one frame, chunks are halved until they do
+	l := NewLeader(leader, LeaderOptions{MaxFrame: 512, SnapshotChunk: 30})
+	f := NewFollower(follower, FollowerOptions{})
+	pipe(t, l, f)
+
+	eventually(t, "chunked snapshot", func() bool { return converged(leader, follower) })
+	eventually(t, "not acknowledged", func() bool {
+		st := l.Followers()
+		return len(st) == 1 && st[0].Acked == leader.Rev() && st[0].Snapshots == 1
+	})
+	if st := f.Stats(); st.Snapshots != 1 || st.Epoch != leader.Epoch() {
+		t.Fatalf("unexpected follower stats %+v", st)
+	}
+}
+
+func TestReplicationLargeSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large snapshot")
+	}
+
+	// more entries than a CBOR array may hold by default
+	const n = 140_000
+	entries := make([]syncmap.Entry[string, *host], n)
+	for i := range entries {
+		k := fmt.Sprint("h", i)
+		entries[i] = syncmap.Entry[string, *host]{Key: k, Rev: uint64(i + 1), Value: &host{ID: k}}
+	}
+	leader := syncmap.NewCollection[string, *host]()
+	leader.Restore(entries, n)
+
+	follower := syncmap.NewCollection[string, *host]()
+	pipe(t, NewLeader(leader, LeaderOptions{}), NewFollower(follower, FollowerOptions{}))
+	deadline := time.Now().Add(30 * time.Second)
+	for follower.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatal("large snapshot not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !converged(leader, follower) {
+		t.Fatal("large snapshot not restored")
+	}
+}
+
+func TestReplicationEpoch(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host](syncmap.WithChangeLog(100))
+	addHosts(leader, 0, 3)
+	follower := syncmap.NewCollection[string, *host]()
+	f := NewFollower(follower, FollowerOptions{})
+
+	stop := pipe(t, NewLeader(leader, LeaderOptions{}), f)
+	eventually(t, "initial sync", func() bool { return converged(leader, follower) })
+	stop()
+	if st := f.Stats(); st.Snapshots != 0 || st.Epoch != leader.Epoch() {
+		t.Fatalf("unexpected follower stats %+v", st)
+	}
+
+	// a restarted leader with other contents past the follower revision
+	leader = syncmap.NewCollection[string, *host](syncmap.WithChangeLog(100))
+	leader.Add("x", &host{ID: "x"})
+	addHosts(leader, 5, 10)
+	pipe(t, NewLeader(leader, LeaderOptions{}), f)
+	eventually(t, "resync after restart", func() bool { return converged(leader, follower) })
+	if follower.Exists("h0") {
+		t.Fatal("entries of the old leader kept")
+	}
+	if st := f.Stats(); st.Snapshots != 1 || st.Epoch != leader.Epoch() {
+		t.Fatalf("unexpected follower stats %+v", st)
+	}
+}
+
+func TestReplicationTCP(t *testing.T) {
+	leader := syncmap.NewCollection[string, *host](syncmap.WithChangeLog(1000))
+	addHosts(leader, 0, 10)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewLeader(leader, LeaderOptions{})
+	served := make(chan error, 1)
+	go func() { served <- l.Serve(ctx, ln) }()
+
+	var followers []*syncmap.Collection[string, *host]
+	var running []chan error
+	for range 3 {
+		c := syncmap.NewCollection[string, *host]()
+		f := NewFollower(c, FollowerOptions{MinBackoff: time.Millisecond})
+		ch := make(chan error, 1)
+		go func() { ch <- f.Run(ctx, DialTCP(ln.Addr().String())) }()
+		followers = append(followers, c)
+		running = append(running, ch)
+	}
+
+	addHosts(leader, 10, 50)
+	leader.RemoveIf(func(_ string, h *host) bool { return len(h.Addr)%2 == 0 })
+
+	for i, c := range followers {
+		eventually(t, fmt.Sprint("follower ", i, " not in sync"), func() bool { return converged(leader, c) })
+	}
+	eventually(t, "followers not listed", func() bool { return len(l.Followers()) == 3 })
+
+	cancel()
+	if err := <-served; err != context.Canceled {
+		t.Fatalf("Serve returned %v", err)
+	}
+	for _, ch := range running {
+		if err := <-ch; err != context.Canceled {
+			t.Fatalf("Run returned %v", err)
+		}
+	}
+}
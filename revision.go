@@ -0,0 +1,151 @@
+package syncmap
+
+import (
+	"errors"
+	"math/rand/v2"
+)
+
+// ///////////////////////////
+// Revisions
+// ///////////////////////////
+// Every change bumps the collection revision, each entry remembers the
+// revision of its last change. Revisions start at 1 and never repeat
+// within a collection.
+
+// ErrRevMismatch is returned when a precondition on a revision fails
+var ErrRevMismatch = errors.New("syncmap: revision mismatch")
+
+// Precondition checks the current revision of a key before a conditional
+// change, ok is false if the key doesn't exist
+type Precondition func(rev uint64, ok bool) error
+
+// MatchRev requires the key to exist at revision rev
+func MatchRev(rev uint64) Precondition {
+	return func(cur uint64, ok bool) error {
+		if !ok {
+			return ErrNotFound
+		}
+		if cur != rev {
+			return ErrRevMismatch
+		}
+		return nil
+	}
+}
+
+// Absent requires the key not to exist
+func Absent() Precondition {
+	return func(_ uint64, ok bool) error {
+		if ok {
+			return ErrRevMismatch
+		}
+		return nil
+	}
+}
+
+// Rev returns the collection revision
+func (c *Collection[_, _]) Rev() uint64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.rev
+}
+
+// Epoch identifies the revision history of the collection. It's random
+// per collection and changes when Restore replaces the history, revisions
+// of different epochs can't be compared
+func (c *Collection[_, _]) Epoch() uint64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.epoch
+}
+
+// newEpoch returns a random non zero epoch
+func newEpoch() uint64 {
+	for {
+		if e := rand.Uint64(); e != 0 {
+			return e
+		}
+	}
+}
+
+// Revision returns the revision of the last change of key
+func (c *Collection[K, _]) Revision(key K) (rev uint64, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	rev, ok = c.revs[key]
+	return rev, ok
+}
+
+// GetRev gets val with key and its revision
+func (c *Collection[K, V]) GetRev(key K) (val V, rev uint64, ok bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	val, ok = c.m[key]
+	return val, c.revs[key], ok
+}
+
+// check runs cond against key, a nil cond always passes. c.mtx must be locked
+func (c *Collection[K, _]) check(key K, cond Precondition) error {
+	if cond == nil {
+		return nil
+	}
+	_, ok := c.m[key]
+	return cond(c.revs[key], ok)
+}
+
+// AddCond adds key / val if cond passes, returns the entry revision
+func (c *Collection[K, V]) AddCond(k K, v V, cond Precondition) (rev uint64, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err = c.check(k, cond)
+	if err != nil {
+		return c.revs[k], err
+	}
+	c.store(k, v)
+	return c.revs[k], nil
+}
+
+// RemoveCond removes key if it exists and cond passes
+func (c *Collection[K, _]) RemoveCond(key K, cond Precondition) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.m[key]; !ok {
+		return ErrNotFound
+	}
+	err := c.check(key, cond)
+	if err != nil {
+		return err
+	}
+	c.drop(key)
+	return nil
+}
+
+// DeleteCond marks key as deleted if it exists and cond passes, returns the entry revision
+func (c *Collection[K, _]) DeleteCond(key K, cond Precondition) (rev uint64, err error) {
+	return c.markCond(key, true, cond)
+}
+
+// UnDeleteCond marks key as not deleted if it exists and cond passes, returns the entry revision
+func (c *Collection[K, _]) UnDeleteCond(key K, cond Precondition) (rev uint64, err error) {
+	return c.markCond(key, false, cond)
+}
+
+func (c *Collection[K, _]) markCond(key K, deleted bool, cond Precondition) (rev uint64, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.m[key]; !ok {
+		return 0, ErrNotFound
+	}
+	err = c.check(key, cond)
+	if err != nil {
+		return c.revs[key], err
+	}
+	c.mark(key, deleted)
+	return c.revs[key], nil
+}
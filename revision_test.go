@@ -0,0 +1,65 @@
+package syncmap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRevisions(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID]()
+	sub := col.Subscribe(10)
+	defer sub.Close()
+
+	a := &ZTPeerID{Address: "a"}
+	col.Add("a", a)
+	col.Add("b", &ZTPeerID{Address: "b"})
+	col.Add("a", a) // unchanged
+
+	if rev, _ := col.Revision("a"); rev != 1 {
+		t.Fatalf("rev of a %d, want 1", rev)
+	}
+	if col.Rev() != 2 {
+		t.Fatalf("collection rev %d, want 2", col.Rev())
+	}
+
+	_, err := col.AddCond("a", &ZTPeerID{Address: "a2"}, MatchRev(2))
+	if !errors.Is(err, ErrRevMismatch) {
+		t.Fatalf("got %v, want ErrRevMismatch", err)
+	}
+	rev, err := col.AddCond("a", &ZTPeerID{Address: "a2"}, MatchRev(1))
+	if err != nil || rev != 3 {
+		t.Fatalf("AddCond rev %d err %v", rev, err)
+	}
+	_, err = col.AddCond("b", &ZTPeerID{}, Absent())
+	if !errors.Is(err, ErrRevMismatch) {
+		t.Fatalf("got %v, want ErrRevMismatch", err)
+	}
+
+	rev, err = col.DeleteCond("b", MatchRev(2))
+	if err != nil || rev != 4 {
+		t.Fatalf("DeleteCond rev %d err %v", rev, err)
+	}
+	err = col.RemoveCond("missing", nil)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	err = col.RemoveCond("b", MatchRev(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := col.Revision("b"); ok {
+		t.Fatal("revision kept after remove")
+	}
+
+	var last uint64
+	for range 5 {
+		e := <-sub.C
+		if e.Rev <= last {
+			t.Fatalf("event revisions not increasing: %d after %d", e.Rev, last)
+		}
+		last = e.Rev
+	}
+	if last != col.Rev() {
+		t.Fatalf("last event rev %d, collection rev %d", last, col.Rev())
+	}
+}
@@ -1,9 +1,9 @@
 package syncmap
 
 import (
+	"context"
 	"iter"
 	"strconv"
-	"sync"
 )
 
 // ///////////////////////////
@@ -21,22 +21,58 @@ type MapKey interface {
 }
 
 type Collection[K MapKey, V MapValue] struct {
-	mtx *sync.RWMutex
+	mtx *rwMutex
 	m   map[K]V
+
+	wait   waiters[K]
+	keys   keyLocks[K]
+	events events[K, V]
+
+	digests map[K]Digest   // nil unless WithDigest
+	tree    *merkleTree[K] // nil unless WithMerkleTree
+
+	rev   uint64       // bumped on every change
+	revs  map[K]uint64 // rev of the last change per key
+	log   *changeLog[K, V]
+	epoch uint64 // identifies the history of rev, see Epoch
+}
+
+// ReadOnlyCollection is the read API of a collection
+type ReadOnlyCollection[K MapKey, V any] interface {
+	Exists(key K) bool
+	Get(key K) (V, bool)
+	Len() int
+	Iter() iter.Seq2[K, V]
 }
 
 // NewCollection creates new empty m: map[K]V
 // Mid-Stack Inlined ?
 // see https://dave.cheney.net/2020/05/02/mid-stack-inlining-in-go
 
-func NewCollection[K MapKey, V MapValue]() *Collection[K, V] {
+func NewCollection[K MapKey, V MapValue](opts ...Option) *Collection[K, V] {
 	var c Collection[K, V]
-	return newCollection(&c)
+	return newCollection(&c, opts...)
 }
 
-func newCollection[K MapKey, V MapValue](c *Collection[K, V]) *Collection[K, V] {
-	c.mtx = &sync.RWMutex{}
+func newCollection[K MapKey, V MapValue](c *Collection[K, V], opts ...Option) *Collection[K, V] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c.mtx = newRWMutex()
 	c.m = make(map[K]V)
+	c.revs = make(map[K]uint64)
+	c.epoch = newEpoch()
+	if o.digest || o.merkleDepth > 0 {
+		c.digests = make(map[K]Digest)
+	}
+	if o.merkleDepth > 0 {
+		c.tree = newMerkleTree[K](o.merkleDepth)
+	}
+	if o.changeLog > 0 {
+		c.log = newChangeLog[K, V](o.changeLog)
+	}
 	return c
 }
 
@@ -92,25 +128,100 @@ func (c *Collection[K, V]) Set(v map[K]V) {
 	defer c.mtx.Unlock()
 
 	c.m = v
+	c.rev++
+	clear(c.revs)
+	for k := range c.m {
+		c.revs[k] = c.rev
+	}
+	if c.digests != nil {
+		c.resetDigests()
+	}
+	c.wait.notifyAll()
+	c.publish(Event[K, V]{Op: OpReset, Rev: c.rev})
 }
 
-// Add key / val to map
-func (c *Collection[K, V]) Add(k K, v V) {
+// Add key / val to map, returns true if the key is new or the value changed.
+// With WithDigest the content digest is compared, otherwise the value
+func (c *Collection[K, V]) Add(k K, v V) (changed bool) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	c.m[k] = v
+	return c.store(k, v)
 }
 
-// Add key / val to map, returns 'updated'. Doesn't really work....
+// Add key / val to map, returns 'updated' if the key is new or the value
+// differs. Pointer values are compared by address, see EqualCollection
 func (c *Collection[K, V]) AddCompare(k K, v V) (updated bool) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	updated = c.m[k] == v
+	return c.store(k, v)
+}
 
+// store sets key / val, wakes waiters and emits an event if the value
+// changed, c.mtx must be write locked
+func (c *Collection[K, V]) store(k K, v V) (changed bool) {
+	old, ok := c.m[k]
 	c.m[k] = v
-	return
+	c.wait.notify(k)
+
+	same := old == v
+	if c.digests != nil {
+		same = c.storeDigest(k, v)
+	}
+
+	if ok && same {
+		return false
+	}
+
+	c.rev++
+	c.revs[k] = c.rev
+	if !ok {
+		c.publish(Event[K, V]{Op: OpAdd, Key: k, Value: v, Rev: c.rev})
+	} else {
+		c.publish(Event[K, V]{Op: OpUpdate, Key: k, Value: v, Old: old, Rev: c.rev})
+	}
+	return true
+}
+
+// drop deletes key, wakes waiters and emits an event, c.mtx must be write locked
+func (c *Collection[K, V]) drop(key K) {
+	old, ok := c.m[key]
+	if !ok {
+		return
+	}
+	delete(c.m, key)
+	c.dropDigest(key)
+	delete(c.revs, key)
+	c.rev++
+	c.wait.notify(key)
+	c.publish(Event[K, V]{Op: OpRemove, Key: key, Old: old, Rev: c.rev})
+}
+
+// mark sets the deleted flag and emits an event, c.mtx must be write locked
+func (c *Collection[K, V]) mark(key K, deleted bool) {
+	v, ok := c.m[key]
+	if !ok {
+		return
+	}
+	v.Del(deleted)
+	if c.digests != nil {
+		c.storeDigest(key, v)
+	}
+	c.rev++
+	c.revs[key] = c.rev
+	c.wait.notify(key)
+
+	op := OpUndelete
+	if deleted {
+		op = OpDelete
+	}
+	c.publish(Event[K, V]{Op: op, Key: key, Value: v, Rev: c.rev})
+}
+
+// Subscribe returns a subscription to change events, buffering up to buf events
+func (c *Collection[K, V]) Subscribe(buf int) *Subscription[K, V] {
+	return c.events.subscribe(buf)
 }
 
 // Remove key from map
@@ -118,7 +229,7 @@ func (c *Collection[K, _]) Remove(key K) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	delete(c.m, key)
+	c.drop(key)
 }
 
 // Mark key as deleted
@@ -126,7 +237,7 @@ func (c *Collection[K, _]) Delete(key K) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	c.m[key].Del(true)
+	c.mark(key, true)
 }
 
 // Mark key as not deleted
@@ -134,7 +245,7 @@ func (c *Collection[K, _]) UnDelete(key K) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	c.m[key].Del(false)
+	c.mark(key, false)
 }
 
 // Len of map
@@ -180,3 +291,97 @@ func (c *Collection[K, V]) Iter() iter.Seq2[K, V] {
 		}
 	}
 }
+
+// AddCtx adds key / val to map, returns ctx.Err() if the lock can't be acquired in time
+func (c *Collection[K, V]) AddCtx(ctx context.Context, k K, v V) error {
+	err := c.mtx.LockCtx(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.mtx.Unlock()
+
+	c.store(k, v)
+	return nil
+}
+
+// GetCtx gets val with key, returns ctx.Err() if the lock can't be acquired in time
+func (c *Collection[K, V]) GetCtx(ctx context.Context, key K) (val V, ok bool, err error) {
+	err = c.mtx.RLockCtx(ctx)
+	if err != nil {
+		return val, false, err
+	}
+	defer c.mtx.RUnlock()
+
+	val, ok = c.m[key]
+	return val, ok, nil
+}
+
+// RemoveCtx removes key from map, returns ctx.Err() if the lock can't be acquired in time
+func (c *Collection[K, _]) RemoveCtx(ctx context.Context, key K) error {
+	err := c.mtx.LockCtx(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.mtx.Unlock()
+
+	c.drop(key)
+	return nil
+}
+
+// IterSnapshot iterates over a copy of all elements of K. The lock is only
+// held while copying, so the loop body may modify the collection
+func (c *Collection[K, V]) IterSnapshot() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		keys, vals := c.snapshotKV()
+		for i, k := range keys {
+			if !yield(k, vals[i]) {
+				return
+			}
+		}
+	}
+}
+
+// snapshotKV copies keys and values under the read lock
+func (c *Collection[K, V]) snapshotKV() (keys []K, vals []V) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	keys = make([]K, 0, len(c.m))
+	vals = make([]V, 0, len(c.m))
+	for k, v := range c.m {
+		keys = append(keys, k)
+		vals = append(vals, v)
+	}
+	return keys, vals
+}
+
+// RemoveIf removes all elements for which pred returns true, returns number removed
+func (c *Collection[K, V]) RemoveIf(pred func(K, V) bool) (n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k, v := range c.m {
+		if pred(k, v) {
+			c.drop(k)
+			n++
+		}
+	}
+	return n
+}
+
+// Retain keeps only the elements for which pred returns true, returns number removed
+func (c *Collection[K, V]) Retain(pred func(K, V) bool) (n int) {
+	return c.RemoveIf(func(k K, v V) bool {
+		return !pred(k, v)
+	})
+}
+
+// UpdateEach replaces every value with the result of fn
+func (c *Collection[K, V]) UpdateEach(fn func(K, V) V) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k, v := range c.m {
+		c.store(k, fn(k, v))
+	}
+}
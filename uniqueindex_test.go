@@ -0,0 +1,111 @@
+package syncmap
+
+import (
+	"slices"
+	"testing"
+)
+
+func sortedKeys(keys []string) []string {
+	slices.Sort(keys)
+	return keys
+}
+
+func TestUniqueKeysFor(t *testing.T) {
+	leaf := peerInfo{Planet: "earth", Role: "LEAF"}
+	moon := peerInfo{Planet: "earth", Role: "MOON"}
+
+	u := NewUniqueCollection[string, peerInfo]()
+	u.Add("a", leaf)
+	u.Add("b", leaf)
+	u.Merge(map[string]peerInfo{"c": leaf, "d": moon})
+
+	if got := sortedKeys(u.KeysFor(leaf)); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("KeysFor leaf = %v", got)
+	}
+
+	u.Add("b", moon)
+	u.Remove("c")
+	if got := sortedKeys(u.KeysFor(leaf)); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("KeysFor leaf = %v", got)
+	}
+	if got := sortedKeys(u.KeysFor(moon)); !slices.Equal(got, []string{"b", "d"}) {
+		t.Fatalf("KeysFor moon = %v", got)
+	}
+
+	u.Overwrite(map[string]peerInfo{"e": moon})
+	if got := u.KeysFor(leaf); got != nil {
+		t.Fatalf("KeysFor leaf after Overwrite = %v", got)
+	}
+	if got := u.KeysFor(moon); !slices.Equal(got, []string{"e"}) {
+		t.Fatalf("KeysFor moon after Overwrite = %v", got)
+	}
+}
+
+func TestUniqueGroupByValue(t *testing.T) {
+	u := NewUniqueCollection[string, peerInfo]()
+	u.Merge(duplicateHeavy(100, 4))
+
+	groups := 0
+	for v, keys := range u.GroupByValue() {
+		groups++
+		if len(keys) != 25 {
+			t.Fatalf("group %v has %d keys", v, len(keys))
+		}
+		for _, k := range keys {
+			if got, _ := u.Get(k); got != v {
+				t.Fatalf("%s holds %v, grouped under %v", k, got, v)
+			}
+		}
+	}
+	if groups != 4 {
+		t.Fatalf("got %d groups, want 4", groups)
+	}
+	if len(u.byValue) != 4 {
+		t.Fatalf("index has %d values, want 4", len(u.byValue))
+	}
+}
+
+func TestUniqueMergeResult(t *testing.T) {
+	leaf := peerInfo{Planet: "earth", Role: "LEAF"}
+	moon := peerInfo{Planet: "earth", Role: "MOON"}
+
+	u := NewUniqueCollection[string, peerInfo]()
+	u.Add("a", leaf)
+	u.Add("b", leaf)
+	u.Add("c", leaf)
+
+	sub := u.Subscribe(10)
+	defer sub.Close()
+
+	r := u.Merge(map[string]peerInfo{"a": leaf, "b": moon, "d": moon})
+	if !slices.Equal(r.Added, []string{"d"}) || !slices.Equal(r.Changed, []string{"b"}) ||
+		!slices.Equal(r.Unchanged, []string{"a"}) || r.Removed != nil {
+		t.Fatalf("unexpected merge result %+v", r)
+	}
+
+	r = u.Overwrite(map[string]peerInfo{"a": leaf, "b": leaf})
+	if !slices.Equal(sortedKeys(r.Removed), []string{"c", "d"}) || !slices.Equal(r.Changed, []string{"b"}) ||
+		!slices.Equal(r.Unchanged, []string{"a"}) || r.Added != nil {
+		t.Fatalf("unexpected overwrite result %+v", r)
+	}
+
+	want := map[EventOp]int{OpAdd: 1, OpUpdate: 2, OpRemove: 2}
+	got := map[EventOp]int{}
+	for range 5 {
+		e := <-sub.C
+		got[e.Op]++
+		if e.Op == OpUpdate && e.Key == "b" && e.Old == e.Value {
+			t.Fatalf("update event without change %+v", e)
+		}
+	}
+	for op, n := range want {
+		if got[op] != n {
+			t.Fatalf("got %d %s events, want %d", got[op], op, n)
+		}
+	}
+	select {
+	case e := <-sub.C:
+		t.Fatalf("unexpected event for unchanged key %+v", e)
+	default:
+	}
+}
@@ -2,8 +2,9 @@ package syncmap
 
 import (
 	"iter"
+	"maps"
+	"slices"
 	"strconv"
-	"sync"
 	"unique"
 )
 
@@ -13,8 +14,18 @@ import (
 type UniqueMapType[K MapKey, V MapValue] map[K]unique.Handle[V]
 
 type UniqueCollection[K MapKey, V MapValue] struct {
-	mtx *sync.RWMutex
-	m   UniqueMapType[K, V]
+	mtx     *rwMutex
+	m       UniqueMapType[K, V]
+	byValue map[unique.Handle[V]]map[K]struct{} // reverse index
+	events  events[K, V]
+}
+
+// MergeResult lists what a bulk Merge or Overwrite did per key
+type MergeResult[K MapKey] struct {
+	Added     []K
+	Changed   []K
+	Unchanged []K
+	Removed   []K // Overwrite only
 }
 
 // NewUniqueCollection creates new empty m: map[K]V
@@ -26,8 +37,9 @@ func NewUniqueCollection[K MapKey, V MapValue]() *UniqueCollection[K, V] {
 }
 
 func newUniqueCollection[K MapKey, V MapValue](c *UniqueCollection[K, V]) *UniqueCollection[K, V] {
-	c.mtx = &sync.RWMutex{}
+	c.mtx = newRWMutex()
 	c.m = make(UniqueMapType[K, V])
+	c.byValue = make(map[unique.Handle[V]]map[K]struct{})
 	return c
 }
 
@@ -82,24 +94,40 @@ func (m *UniqueCollection[K, V]) ToMap() *map[K]V {
 	return &val
 }
 
-// Overwrite map from map
-func (m *UniqueCollection[K, V]) Overwrite(d map[K]V) {
+// Overwrite map from map, keys not in d are removed
+func (m *UniqueCollection[K, V]) Overwrite(d map[K]V) (r MergeResult[K]) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
-	clear(m.m)
 
-	for k, v := range d {
-		m.m[k] = unique.Make(v)
+	for k := range m.m {
+		if _, ok := d[k]; !ok {
+			m.unset(k)
+			r.Removed = append(r.Removed, k)
+		}
 	}
+	m.merge(d, &r)
+	return r
 }
 
 // merge data from map
-func (m *UniqueCollection[K, V]) Merge(d map[K]V) {
+func (m *UniqueCollection[K, V]) Merge(d map[K]V) (r MergeResult[K]) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
+	m.merge(d, &r)
+	return r
+}
+
+func (m *UniqueCollection[K, V]) merge(d map[K]V, r *MergeResult[K]) {
 	for k, v := range d {
-		m.m[k] = unique.Make(v)
+		switch m.set(k, unique.Make(v)) {
+		case OpAdd:
+			r.Added = append(r.Added, k)
+		case OpUpdate:
+			r.Changed = append(r.Changed, k)
+		default:
+			r.Unchanged = append(r.Unchanged, k)
+		}
 	}
 }
 
@@ -108,12 +136,7 @@ func (m *UniqueCollection[K, V]) Add(k K, v V) bool {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	new := unique.Make(v)
-	if new == m.m[k] {
-		return false
-	}
-	m.m[k] = new
-	return true
+	return m.set(k, unique.Make(v)) != 0
 }
 
 // Remove key from map
@@ -121,7 +144,87 @@ func (m *UniqueCollection[K, _]) Remove(key K) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
+	m.unset(key)
+}
+
+// set stores h for key, updates the reverse index and emits an event.
+// Returns OpAdd, OpUpdate or 0 if unchanged, m.mtx must be write locked
+func (m *UniqueCollection[K, V]) set(key K, h unique.Handle[V]) (op EventOp) {
+	old, ok := m.m[key]
+	switch {
+	case !ok:
+		op = OpAdd
+	case old == h:
+		return 0
+	default:
+		op = OpUpdate
+		m.unindex(key, old)
+	}
+	m.m[key] = h
+
+	keys, ok := m.byValue[h]
+	if !ok {
+		keys = make(map[K]struct{})
+		m.byValue[h] = keys
+	}
+	keys[key] = struct{}{}
+
+	e := Event[K, V]{Op: op, Key: key, Value: h.Value()}
+	if op == OpUpdate {
+		e.Old = old.Value()
+	}
+	m.events.emit(e)
+	return op
+}
+
+// unset deletes key, updates the reverse index and emits an event, m.mtx must be write locked
+func (m *UniqueCollection[K, V]) unset(key K) {
+	old, ok := m.m[key]
+	if !ok {
+		return
+	}
 	delete(m.m, key)
+	m.unindex(key, old)
+	m.events.emit(Event[K, V]{Op: OpRemove, Key: key, Old: old.Value()})
+}
+
+// Subscribe returns a subscription to change events, buffering up to buf events
+func (m *UniqueCollection[K, V]) Subscribe(buf int) *Subscription[K, V] {
+	return m.events.subscribe(buf)
+}
+
+func (m *UniqueCollection[K, V]) unindex(key K, h unique.Handle[V]) {
+	keys := m.byValue[h]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(m.byValue, h)
+	}
+}
+
+// KeysFor returns the keys currently holding v
+func (m *UniqueCollection[K, V]) KeysFor(v V) []K {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	keys := m.byValue[unique.Make(v)]
+	if len(keys) == 0 {
+		return nil
+	}
+	return slices.Collect(maps.Keys(keys))
+}
+
+// GroupByValue iterates over the distinct values and the keys holding them
+func (m *UniqueCollection[K, V]) GroupByValue() iter.Seq2[V, []K] {
+	return func(yield func(V, []K) bool) {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+
+		for h, keys := range m.byValue {
+			if !yield(h.Value(), slices.Collect(maps.Keys(keys))) {
+				return
+			}
+		}
+	}
 }
 
 // // Mark key as deleted
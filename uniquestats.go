@@ -0,0 +1,73 @@
+package syncmap
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"unique"
+	"unsafe"
+)
+
+// ///////////////////////////
+// Unique Collection stats
+// ///////////////////////////
+
+// statsGroups is the number of largest groups reported by Stats
+const statsGroups = 10
+
+// ValueGroup is a set of keys sharing one interned value
+type ValueGroup[K MapKey, V MapValue] struct {
+	Value V
+	Keys  []K
+}
+
+// UniqueStats describes how well values are deduplicated
+type UniqueStats[K MapKey, V MapValue] struct {
+	Entries  int // keys
+	Distinct int // distinct handles
+	// DuplicationRatio is Entries / Distinct, 1 means no sharing
+	DuplicationRatio float64
+	// Groups are the largest groups of keys sharing a value, biggest first,
+	// groups of one key are left out
+	Groups []ValueGroup[K, V]
+	// BytesSaved estimates the memory saved compared with map[K]V, counting
+	// the inline size of V against a handle per entry plus one V per
+	// distinct value. Memory referenced by V isn't counted. May be negative
+	BytesSaved int64
+}
+
+func (s UniqueStats[K, V]) String() string {
+	return fmt.Sprintf("entries %d, distinct %d, ratio %.2f, saved ~%d bytes", s.Entries, s.Distinct, s.DuplicationRatio, s.BytesSaved)
+}
+
+// Stats reports entry count, distinct values and estimated memory savings
+func (m *UniqueCollection[K, V]) Stats() (s UniqueStats[K, V]) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	var shared []unique.Handle[V]
+	for h, keys := range m.byValue {
+		s.Entries += len(keys)
+		if len(keys) > 1 {
+			shared = append(shared, h)
+		}
+	}
+	s.Distinct = len(m.byValue)
+	if s.Distinct > 0 {
+		s.DuplicationRatio = float64(s.Entries) / float64(s.Distinct)
+	}
+
+	slices.SortFunc(shared, func(a, b unique.Handle[V]) int {
+		return cmp.Compare(len(m.byValue[b]), len(m.byValue[a]))
+	})
+	for _, h := range shared[:min(len(shared), statsGroups)] {
+		s.Groups = append(s.Groups, ValueGroup[K, V]{Value: h.Value(), Keys: slices.Collect(maps.Keys(m.byValue[h]))})
+	}
+
+	size := int64(reflect.TypeFor[V]().Size())
+	handle := int64(unsafe.Sizeof(unique.Handle[V]{}))
+	s.BytesSaved = int64(s.Entries)*size - (int64(s.Entries)*handle + int64(s.Distinct)*size)
+	return s
+}
@@ -0,0 +1,106 @@
+package syncmap
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// peerInfo is a comparable value type, as stored by value in UniqueCollection
+type peerInfo struct {
+	Planet   string
+	Version  string
+	Role     string
+	Path     [4]string
+	Latency  int
+	Online   bool
+	Firewall bool
+}
+
+func (p peerInfo) GetID() string { return p.Planet }
+func (p peerInfo) Del(bool)      {}
+
+// duplicateHeavy returns n peers sharing distinct different values
+func duplicateHeavy(n, distinct int) map[string]peerInfo {
+	m := make(map[string]peerInfo, n)
+	for i := range n {
+		d := i % distinct
+		m[fmt.Sprintf("peer-%d", i)] = peerInfo{
+			Planet:  "earth",
+			Version: fmt.Sprintf("1.14.%d", d%3),
+			Role:    "LEAF",
+			Path:    [4]string{"10.0.0.1/9993", "10.0.0.2/9993"},
+			Latency: d,
+			Online:  true,
+		}
+	}
+	return m
+}
+
+func TestUniqueStats(t *testing.T) {
+	u := NewUniqueCollection[string, peerInfo]()
+	u.Merge(duplicateHeavy(1000, 10))
+	u.Add("single", peerInfo{Planet: "mars"})
+
+	s := u.Stats()
+	if s.Entries != 1001 || s.Distinct != 11 {
+		t.Fatalf("unexpected stats %s", s)
+	}
+	if len(s.Groups) != 10 || len(s.Groups[0].Keys) != 100 {
+		t.Fatalf("unexpected groups %v", s.Groups)
+	}
+	for _, g := range s.Groups {
+		for _, k := range g.Keys {
+			if v, _ := u.Get(k); v != g.Value {
+				t.Fatalf("%s not holding group value", k)
+			}
+		}
+	}
+	if s.BytesSaved <= 0 {
+		t.Fatalf("expected savings, got %d", s.BytesSaved)
+	}
+
+	empty := NewUniqueCollection[string, peerInfo]().Stats()
+	if empty.Entries != 0 || empty.DuplicationRatio != 0 {
+		t.Fatalf("unexpected stats %s", empty)
+	}
+}
+
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
+
+func BenchmarkDuplicateHeavy(b *testing.B) {
+	data := duplicateHeavy(10000, 20)
+
+	b.Run("collection", func(b *testing.B) {
+		b.ReportAllocs()
+		var col *Collection[string, peerInfo]
+		before := heapInUse()
+		for range b.N {
+			col = NewCollection[string, peerInfo]()
+			for k, v := range data {
+				col.Add(k, v)
+			}
+		}
+		b.ReportMetric(float64(int64(heapInUse())-int64(before)), "heap-B")
+		runtime.KeepAlive(col)
+	})
+
+	b.Run("unique", func(b *testing.B) {
+		b.ReportAllocs()
+		var u *UniqueCollection[string, peerInfo]
+		before := heapInUse()
+		for range b.N {
+			u = NewUniqueCollection[string, peerInfo]()
+			for k, v := range data {
+				u.Add(k, v)
+			}
+		}
+		b.ReportMetric(float64(int64(heapInUse())-int64(before)), "heap-B")
+		b.ReportMetric(float64(u.Stats().BytesSaved), "est-saved-B")
+	})
+}
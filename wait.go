@@ -0,0 +1,199 @@
+package syncmap
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// ///////////////////////////
+// Waiting for changes
+// ///////////////////////////
+
+// waiters hands out channels that are closed on the next change. The zero
+// value is ready to use, channels are only created when someone waits.
+type waiters[K MapKey] struct {
+	mu   sync.Mutex
+	keys map[K]*keyWait
+	any  chan struct{}
+}
+
+// keyWait is the channel of one key and the number of its waiters
+type keyWait struct {
+	ch chan struct{}
+	n  int
+}
+
+// forKey returns a channel closed on the next change of key, call
+// release when giving up without a change
+func (w *waiters[K]) forKey(key K) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.keys == nil {
+		w.keys = make(map[K]*keyWait)
+	}
+	kw, ok := w.keys[key]
+	if !ok {
+		kw = &keyWait{ch: make(chan struct{})}
+		w.keys[key] = kw
+	}
+	kw.n++
+	return kw.ch
+}
+
+// release drops a waiter of key on ch, the channel is forgotten with its
+// last waiter
+func (w *waiters[K]) release(key K, ch <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	kw, ok := w.keys[key]
+	if !ok || kw.ch != ch {
+		return // already notified
+	}
+	kw.n--
+	if kw.n == 0 {
+		delete(w.keys, key)
+	}
+}
+
+// forAny returns a channel closed on the next change of any key
+func (w *waiters[K]) forAny() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.any == nil {
+		w.any = make(chan struct{})
+	}
+	return w.any
+}
+
+// notify wakes the waiters of key and of any key
+func (w *waiters[K]) notify(key K) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if kw, ok := w.keys[key]; ok {
+		close(kw.ch)
+		delete(w.keys, key)
+	}
+	if w.any != nil {
+		close(w.any)
+		w.any = nil
+	}
+}
+
+// notifyAll wakes every waiter
+func (w *waiters[K]) notifyAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for k, kw := range w.keys {
+		close(kw.ch)
+		delete(w.keys, k)
+	}
+	if w.any != nil {
+		close(w.any)
+		w.any = nil
+	}
+}
+
+// mapView is a lock free ReadOnlyCollection over a map, used for
+// callbacks that run while the collection lock is already held
+type mapView[K MapKey, V any] map[K]V
+
+func (m mapView[K, _]) Exists(key K) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func (m mapView[K, V]) Get(key K) (V, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m mapView[_, _]) Len() int {
+	return len(m)
+}
+
+func (m mapView[K, V]) Iter() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for k, v := range m {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// waitFor blocks until key exists in *m and returns its value, *m is read
+// with mtx read locked
+func waitFor[K MapKey, V any](ctx context.Context, mtx *rwMutex, w *waiters[K], m *map[K]V, key K) (val V, err error) {
+	for {
+		err = mtx.RLockCtx(ctx)
+		if err != nil {
+			return val, err
+		}
+		val, ok := (*m)[key]
+		if ok {
+			mtx.RUnlock()
+			return val, nil
+		}
+		changed := w.forKey(key)
+		mtx.RUnlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			w.release(key, changed)
+			return val, ctx.Err()
+		}
+	}
+}
+
+// waitUntil blocks until cond holds for *m, see WaitUntil
+func waitUntil[K MapKey, V any](ctx context.Context, mtx *rwMutex, w *waiters[K], m *map[K]V, cond func(ReadOnlyCollection[K, V]) bool) error {
+	for {
+		err := mtx.RLockCtx(ctx)
+		if err != nil {
+			return err
+		}
+		ok := cond(mapView[K, V](*m))
+		changed := w.forAny()
+		mtx.RUnlock()
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitFor blocks until key exists and returns its value, or returns ctx.Err()
+func (c *Collection[K, V]) WaitFor(ctx context.Context, key K) (val V, err error) {
+	return waitFor(ctx, c.mtx, &c.wait, &c.m, key)
+}
+
+// WaitUntil blocks until cond returns true, or returns ctx.Err(). cond is
+// called with the read lock held and re-evaluated after every change, it
+// must not call back into the collection.
+func (c *Collection[K, V]) WaitUntil(ctx context.Context, cond func(ReadOnlyCollection[K, V]) bool) error {
+	return waitUntil(ctx, c.mtx, &c.wait, &c.m, cond)
+}
+
+// WaitFor blocks until key exists and returns its value, or returns ctx.Err()
+func (c *EqualCollection[K, V]) WaitFor(ctx context.Context, key K) (val V, err error) {
+	return waitFor(ctx, c.mtx, &c.wait, &c.m, key)
+}
+
+// WaitUntil blocks until cond returns true, or returns ctx.Err(), see
+// Collection.WaitUntil
+func (c *EqualCollection[K, V]) WaitUntil(ctx context.Context, cond func(ReadOnlyCollection[K, V]) bool) error {
+	return waitUntil(ctx, c.mtx, &c.wait, &c.m, cond)
+}
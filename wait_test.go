@@ -0,0 +1,112 @@
+package syncmap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitFor(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		col.Add("other", &ZTNetwork{NWID: "other"})
+		time.Sleep(10 * time.Millisecond)
+		col.Add("95987162f3023a29", &ZTNetwork{NWID: "95987162f3023a29"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	n, err := col.WaitFor(ctx, "95987162f3023a29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.NWID != "95987162f3023a29" {
+		t.Fatalf("got %s", n.NWID)
+	}
+
+	// already present returns immediately
+	_, err = col.WaitFor(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForCancel(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := col.WaitFor(ctx, "missing")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	col := NewCollection[string, *ZTPeerID]()
+
+	go func() {
+		for _, a := range []string{"a", "b", "c"} {
+			time.Sleep(5 * time.Millisecond)
+			col.Add(a, &ZTPeerID{Address: a})
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := col.WaitUntil(ctx, func(c ReadOnlyCollection[string, *ZTPeerID]) bool {
+		return c.Len() == 3
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		col.RemoveIf(func(k string, _ *ZTPeerID) bool { return k != "a" })
+	}()
+
+	err = col.WaitUntil(ctx, func(c ReadOnlyCollection[string, *ZTPeerID]) bool {
+		return !c.Exists("b") && !c.Exists("c")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForRelease(t *testing.T) {
+	col := NewCollection[string, *ZTNetwork]()
+	col.Add("present", &ZTNetwork{NWID: "present"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// two waiters share the channel of a key that never appears
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := col.WaitFor(ctx, "missing")
+			errs <- err
+		}()
+	}
+	for range 2 {
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want deadline exceeded", err)
+		}
+	}
+	if _, err := col.WaitFor(context.Background(), "present"); err != nil {
+		t.Fatal(err)
+	}
+
+	col.wait.mu.Lock()
+	defer col.wait.mu.Unlock()
+	if n := len(col.wait.keys); n != 0 {
+		t.Fatalf("%d key channels left", n)
+	}
+}